@@ -0,0 +1,60 @@
+// Package adf renders Atlassian Document Format, the JSON tree Confluence keeps its pages in, as
+// Markdown.  See https://developer.atlassian.com/cloud/jira/platform/apis/document/structure/.
+package adf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Node is one node of a document: a block like a paragraph or table, or an inline like text or a
+// mention.
+type Node struct {
+	Type    string         `json:"type"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+	Content []Node         `json:"content,omitempty"`
+	Marks   []Mark         `json:"marks,omitempty"`
+	Text    string         `json:"text,omitempty"`
+}
+
+// Mark is formatting applied to a text node, like strong or link.
+type Mark struct {
+	Type  string         `json:"type"`
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+// Parse reads a document, as found in a page's atlas_doc_format body.
+func Parse(data []byte) (Node, error) {
+	var doc Node
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Node{}, fmt.Errorf("adf: couldn't parse document: %w", err)
+	}
+	if doc.Type != "doc" {
+		return Node{}, fmt.Errorf("adf: expected a doc node, found '%s'", doc.Type)
+	}
+	return doc, nil
+}
+
+// Attr returns a string attribute, or "" if it's missing.  Numbers are formatted, because some
+// attributes (like a heading's level) are numbers.
+func (n Node) Attr(name string) string {
+	return attr(n.Attrs, name)
+}
+
+// Attr returns a string attribute of the mark, or "" if it's missing.
+func (m Mark) Attr(name string) string {
+	return attr(m.Attrs, name)
+}
+
+func attr(attrs map[string]any, name string) string {
+	switch v := attrs[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
@@ -0,0 +1,409 @@
+package adf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+)
+
+// Renderer turns documents into Markdown.  The zero value renders links, media and mentions as the
+// document has them; the hooks let you point them elsewhere.
+type Renderer struct {
+	// Rewrites the target of a link or card, say to a relative link.  Nil leaves them alone.
+	LinkURL func(href string) string
+
+	// Where the file a media node shows can be found; "" if we don't know, in which case we make
+	// do with its alt text.
+	MediaURL func(media Node) string
+
+	// What to call a mentioned user, given their account ID and the text the document has for
+	// them (usually "@Name", but sometimes empty).  Nil uses the text.
+	Mention func(id string, text string) string
+
+	// Renders a panel (info, note, tip, warning, error, success) around its Markdown body.  Nil
+	// makes it a blockquote.
+	Panel func(panelType string, body string) string
+}
+
+// Render renders a whole document.
+func (r *Renderer) Render(doc Node) string {
+	return r.blocks(doc.Content) + "\n"
+}
+
+// blocks renders block nodes, with a blank line between each.
+func (r *Renderer) blocks(nodes []Node) string {
+	out := []string{}
+	for _, n := range nodes {
+		if s := r.block(n); s != "" {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
+
+func (r *Renderer) block(n Node) string {
+	switch n.Type {
+	case "paragraph":
+		return strings.TrimSpace(r.inlines(n.Content))
+
+	case "heading":
+		level, err := strconv.Atoi(n.Attr("level"))
+		if err != nil || level < 1 || level > 6 {
+			level = 1
+		}
+		return strings.Repeat("#", level) + " " + strings.TrimSpace(r.inlines(n.Content))
+
+	case "bulletList":
+		items := []string{}
+		for _, item := range n.Content {
+			items = append(items, "- "+indent(r.listItem(item), 2))
+		}
+		return strings.Join(items, "\n")
+
+	case "orderedList":
+		order, err := strconv.Atoi(n.Attr("order"))
+		if err != nil {
+			order = 1
+		}
+		items := []string{}
+		for i, item := range n.Content {
+			marker := fmt.Sprintf("%d. ", order+i)
+			items = append(items, marker+indent(r.listItem(item), len(marker)))
+		}
+		return strings.Join(items, "\n")
+
+	case "taskList":
+		items := []string{}
+		for _, item := range n.Content {
+			if item.Type == "taskList" {
+				// a nested list, under the previous item.
+				items = append(items, "  "+indent(r.block(item), 2))
+				continue
+			}
+			box := "[ ]"
+			if item.Attr("state") == "DONE" {
+				box = "[x]"
+			}
+			items = append(items, fmt.Sprintf("- %s %s", box, strings.TrimSpace(r.inlines(item.Content))))
+		}
+		return strings.Join(items, "\n")
+
+	case "decisionList":
+		items := []string{}
+		for _, item := range n.Content {
+			items = append(items, "- ✓ "+strings.TrimSpace(r.inlines(item.Content)))
+		}
+		return strings.Join(items, "\n")
+
+	case "blockquote":
+		return quote(r.blocks(n.Content))
+
+	case "codeBlock":
+		code := strings.Builder{}
+		for _, text := range n.Content {
+			code.WriteString(text.Text)
+		}
+		return FencedCode(code.String(), n.Attr("language"))
+
+	case "rule":
+		return "---"
+
+	case "panel":
+		body := r.blocks(n.Content)
+		if r.Panel != nil {
+			return r.Panel(n.Attr("panelType"), body)
+		}
+		return quote(fmt.Sprintf("**%s**\n\n%s", strings.ToUpper(n.Attr("panelType")), body))
+
+	case "expand", "nestedExpand":
+		title := n.Attr("title")
+		if title == "" {
+			return r.blocks(n.Content)
+		}
+		return fmt.Sprintf("**%s**\n\n%s", escape.MarkdownCharacters(title), r.blocks(n.Content))
+
+	case "table":
+		return r.table(n)
+
+	case "mediaSingle":
+		return r.media(n.Content, true)
+
+	case "mediaGroup":
+		return r.media(n.Content, false)
+
+	case "blockCard", "embedCard":
+		return r.card(n)
+
+	case "extension":
+		// a macro without a body, like a table of contents: nothing we can render.
+		return ""
+	}
+
+	// layouts, bodied extensions and whatever else may be invented: just the content.
+	if len(n.Content) > 0 && isInline(n.Content[0]) {
+		return strings.TrimSpace(r.inlines(n.Content))
+	}
+	return r.blocks(n.Content)
+}
+
+// listItem renders the blocks in a list item, keeping nested lists snug against their parent.
+func (r *Renderer) listItem(item Node) string {
+	var b strings.Builder
+	for _, n := range item.Content {
+		s := r.block(n)
+		if s == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			switch n.Type {
+			case "bulletList", "orderedList", "taskList":
+				b.WriteString("\n")
+			default:
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func isInline(n Node) bool {
+	switch n.Type {
+	case "text", "hardBreak", "mention", "emoji", "date", "status", "inlineCard", "placeholder", "inlineExtension":
+		return true
+	}
+	return false
+}
+
+// inlines renders inline nodes, which run together.
+func (r *Renderer) inlines(nodes []Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Type {
+		case "text":
+			b.WriteString(r.text(n))
+
+		case "hardBreak":
+			b.WriteString("\\\n")
+
+		case "mention":
+			text := n.Attr("text")
+			if r.Mention != nil {
+				text = r.Mention(n.Attr("id"), text)
+			}
+			b.WriteString(escape.MarkdownCharacters(text))
+
+		case "emoji":
+			if text := n.Attr("text"); text != "" {
+				b.WriteString(text)
+			} else {
+				b.WriteString(n.Attr("shortName"))
+			}
+
+		case "date":
+			// milliseconds since the epoch, as a string.
+			if ms, err := strconv.ParseInt(n.Attr("timestamp"), 10, 64); err == nil {
+				b.WriteString(time.UnixMilli(ms).UTC().Format(time.DateOnly))
+			}
+
+		case "status":
+			b.WriteString(codeSpan(n.Attr("text")))
+
+		case "inlineCard":
+			b.WriteString(r.card(n))
+
+		case "placeholder", "inlineExtension":
+			// nothing the reader wrote.
+
+		default:
+			b.WriteString(r.inlines(n.Content))
+		}
+	}
+	return b.String()
+}
+
+// text renders a text node with its marks.  Code goes innermost, links outermost.
+func (r *Renderer) text(n Node) string {
+	text := escape.MarkdownCharacters(n.Text)
+	for _, mark := range n.Marks {
+		if mark.Type == "code" {
+			text = codeSpan(n.Text)
+		}
+	}
+
+	link := ""
+	for _, mark := range n.Marks {
+		switch mark.Type {
+		case "strong":
+			text = wrap(text, "**", "**")
+		case "em":
+			text = wrap(text, "*", "*")
+		case "strike":
+			text = wrap(text, "~~", "~~")
+		case "subsup":
+			if mark.Attr("type") == "sub" {
+				text = wrap(text, "<sub>", "</sub>")
+			} else {
+				text = wrap(text, "<sup>", "</sup>")
+			}
+		case "link":
+			link = mark.Attr("href")
+		}
+		// underline, textColor and friends don't exist in Markdown.
+	}
+
+	if link != "" {
+		text = fmt.Sprintf("[%s](%s)", text, r.linkURL(link))
+	}
+	return text
+}
+
+func (r *Renderer) linkURL(href string) string {
+	if r.LinkURL != nil {
+		href = r.LinkURL(href)
+	}
+	return strings.ReplaceAll(href, " ", "%20")
+}
+
+func (r *Renderer) card(n Node) string {
+	u := n.Attr("url")
+	if u == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%s](%s)", escape.MarkdownCharacters(u), r.linkURL(u))
+}
+
+// media renders the files in a mediaSingle (an image, usually) or mediaGroup (attachments).
+func (r *Renderer) media(nodes []Node, image bool) string {
+	out := []string{}
+	for _, n := range nodes {
+		if n.Type != "media" {
+			continue
+		}
+		alt := n.Attr("alt")
+		u := n.Attr("url") // for external media
+		if r.MediaURL != nil {
+			if mediaURL := r.MediaURL(n); mediaURL != "" {
+				u = mediaURL
+			}
+		}
+		if u == "" {
+			if alt != "" {
+				out = append(out, "*"+escape.MarkdownCharacters(alt)+"*")
+			}
+			continue
+		}
+
+		if image {
+			out = append(out, fmt.Sprintf("![%s](%s)", escape.MarkdownCharacters(alt), strings.ReplaceAll(u, " ", "%20")))
+		} else {
+			if alt == "" {
+				alt = u
+			}
+			out = append(out, fmt.Sprintf("[%s](%s)", escape.MarkdownCharacters(alt), strings.ReplaceAll(u, " ", "%20")))
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
+
+// table renders a GitHub flavoured table.  Markdown tables need a header row, so the first row is
+// it, whether or not Confluence thought so too.
+func (r *Renderer) table(n Node) string {
+	rows := [][]string{}
+	columns := 0
+	for _, row := range n.Content {
+		cells := []string{}
+		for _, cell := range row.Content {
+			cells = append(cells, tableCell(r.blocks(cell.Content)))
+		}
+		columns = max(columns, len(cells))
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, cells := range rows {
+		for len(cells) < columns {
+			cells = append(cells, "")
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// tableCell squashes a cell's Markdown onto one line, which is all a table row gets.
+func tableCell(md string) string {
+	md = strings.ReplaceAll(md, "\\\n", "<br>")
+	md = strings.ReplaceAll(md, "\n\n", "<br>")
+	md = strings.ReplaceAll(md, "\n", " ")
+	// the text may already have had its pipes escaped.
+	md = strings.ReplaceAll(md, "\\|", "|")
+	return strings.ReplaceAll(md, "|", "\\|")
+}
+
+// wrap puts delimiters around text, but inside any surrounding whitespace, which would stop
+// Markdown from recognising them.
+func wrap(text string, open string, close string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + open + trimmed + close + text[start+len(trimmed):]
+}
+
+// codeSpan quotes code with more backticks than it contains in a row.
+func codeSpan(code string) string {
+	fence := strings.Repeat("`", longestBacktickRun(code)+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		return fence + " " + code + " " + fence
+	}
+	return fence + code + fence
+}
+
+// FencedCode renders a code block, with a fence longer than any run of backticks in the code, so
+// the code can't close it early.
+func FencedCode(code string, language string) string {
+	fence := strings.Repeat("`", max(3, longestBacktickRun(code)+1))
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, language, strings.TrimSuffix(code, "\n"), fence)
+}
+
+func longestBacktickRun(s string) int {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// indent indents all but the first line, for list items.
+func indent(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", n) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func quote(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,346 @@
+package adf
+
+import (
+	"strings"
+	"testing"
+)
+
+// render parses a document with the given top-level content, and renders it.
+func render(t *testing.T, r *Renderer, content string) string {
+	t.Helper()
+	doc, err := Parse([]byte(`{"type": "doc", "version": 1, "content": [` + content + `]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(r.Render(doc), "\n")
+}
+
+func TestRenderNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			"paragraphs",
+			`{"type": "paragraph", "content": [{"type": "text", "text": "One *star*, "}]},
+			 {"type": "paragraph"},
+			 {"type": "paragraph", "content": [{"type": "text", "text": "two."}]}`,
+			"One \\*star\\*,\n\ntwo.",
+		},
+		{
+			"heading",
+			`{"type": "heading", "attrs": {"level": 3}, "content": [{"type": "text", "text": "Setup"}]}`,
+			"### Setup",
+		},
+		{
+			"heading with a silly level",
+			`{"type": "heading", "attrs": {"level": 9}, "content": [{"type": "text", "text": "Setup"}]}`,
+			"# Setup",
+		},
+		{
+			"bullet list with a nested list",
+			`{"type": "bulletList", "content": [
+				{"type": "listItem", "content": [
+					{"type": "paragraph", "content": [{"type": "text", "text": "fruit"}]},
+					{"type": "bulletList", "content": [
+						{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "apple"}]}]}
+					]}
+				]},
+				{"type": "listItem", "content": [
+					{"type": "paragraph", "content": [{"type": "text", "text": "veg"}]},
+					{"type": "paragraph", "content": [{"type": "text", "text": "lots of it"}]}
+				]}
+			]}`,
+			"- fruit\n  - apple\n- veg\n\n  lots of it",
+		},
+		{
+			"ordered list",
+			`{"type": "orderedList", "attrs": {"order": 9}, "content": [
+				{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "nine"}]}]},
+				{"type": "listItem", "content": [
+					{"type": "paragraph", "content": [{"type": "text", "text": "ten"}]},
+					{"type": "orderedList", "content": [
+						{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "one"}]}]}
+					]}
+				]}
+			]}`,
+			"9. nine\n10. ten\n    1. one",
+		},
+		{
+			"task list",
+			`{"type": "taskList", "attrs": {"localId": "a"}, "content": [
+				{"type": "taskItem", "attrs": {"localId": "b", "state": "DONE"}, "content": [{"type": "text", "text": "write it"}]},
+				{"type": "taskItem", "attrs": {"localId": "c", "state": "TODO"}, "content": [{"type": "text", "text": "test it"}]},
+				{"type": "taskList", "attrs": {"localId": "d"}, "content": [
+					{"type": "taskItem", "attrs": {"localId": "e", "state": "TODO"}, "content": [{"type": "text", "text": "with fixtures"}]}
+				]}
+			]}`,
+			"- [x] write it\n- [ ] test it\n  - [ ] with fixtures",
+		},
+		{
+			"decision list",
+			`{"type": "decisionList", "attrs": {"localId": "a"}, "content": [
+				{"type": "decisionItem", "attrs": {"localId": "b", "state": "DECIDED"}, "content": [{"type": "text", "text": "Use Go"}]}
+			]}`,
+			"- ✓ Use Go",
+		},
+		{
+			"blockquote",
+			`{"type": "blockquote", "content": [
+				{"type": "paragraph", "content": [{"type": "text", "text": "To be,"}]},
+				{"type": "paragraph", "content": [{"type": "text", "text": "or not."}]}
+			]}`,
+			"> To be,\n>\n> or not.",
+		},
+		{
+			"code block",
+			`{"type": "codeBlock", "attrs": {"language": "go"}, "content": [{"type": "text", "text": "x := *p\n"}]}`,
+			"```go\nx := *p\n```",
+		},
+		{
+			"code block containing a fence",
+			`{"type": "codeBlock", "content": [{"type": "text", "text": "` + "```" + `sh\nls\n` + "```" + `"}]}`,
+			"````\n```sh\nls\n```\n````",
+		},
+		{
+			"rule",
+			`{"type": "rule"}`,
+			"---",
+		},
+		{
+			"panel",
+			`{"type": "panel", "attrs": {"panelType": "warning"}, "content": [
+				{"type": "paragraph", "content": [{"type": "text", "text": "Mind the gap."}]}
+			]}`,
+			"> **WARNING**\n>\n> Mind the gap.",
+		},
+		{
+			"expand",
+			`{"type": "expand", "attrs": {"title": "Details *here*"}, "content": [
+				{"type": "paragraph", "content": [{"type": "text", "text": "Hidden."}]},
+				{"type": "nestedExpand", "attrs": {"title": ""}, "content": [
+					{"type": "paragraph", "content": [{"type": "text", "text": "More hidden."}]}
+				]}
+			]}`,
+			"**Details \\*here\\***\n\nHidden.\n\nMore hidden.",
+		},
+		{
+			"table",
+			`{"type": "table", "content": [
+				{"type": "tableRow", "content": [
+					{"type": "tableHeader", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "Name"}]}]},
+					{"type": "tableHeader", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "Notes"}]}]}
+				]},
+				{"type": "tableRow", "content": [
+					{"type": "tableCell", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "a|b"}]}]},
+					{"type": "tableCell", "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "one"}, {"type": "hardBreak"}, {"type": "text", "text": "two"}]},
+						{"type": "paragraph", "content": [{"type": "text", "text": "three"}]}
+					]}
+				]},
+				{"type": "tableRow", "content": [
+					{"type": "tableCell", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "short"}]}]}
+				]}
+			]}`,
+			"| Name | Notes |\n| --- | --- |\n| a\\|b | one<br>two<br>three |\n| short |  |",
+		},
+		{
+			"empty table",
+			`{"type": "table", "content": []}`,
+			"",
+		},
+		{
+			"media single, external",
+			`{"type": "mediaSingle", "attrs": {"layout": "center"}, "content": [
+				{"type": "media", "attrs": {"type": "external", "url": "https://example.com/a cat.png", "alt": "a cat"}}
+			]}`,
+			"![a cat](https://example.com/a%20cat.png)",
+		},
+		{
+			"media we can't find",
+			`{"type": "mediaSingle", "content": [
+				{"type": "media", "attrs": {"type": "file", "id": "abc", "collection": "x", "alt": "diagram_v2.png"}},
+				{"type": "caption", "content": [{"type": "text", "text": "ignored"}]}
+			]}`,
+			"*diagram\\_v2.png*",
+		},
+		{
+			"media group",
+			`{"type": "mediaGroup", "content": [
+				{"type": "media", "attrs": {"type": "external", "url": "https://example.com/report.pdf", "alt": "Report"}},
+				{"type": "media", "attrs": {"type": "external", "url": "https://example.com/data.csv"}},
+				{"type": "media", "attrs": {"type": "file", "id": "abc"}}
+			]}`,
+			"[Report](https://example.com/report.pdf)\n\n[https://example.com/data.csv](https://example.com/data.csv)",
+		},
+		{
+			"cards",
+			`{"type": "blockCard", "attrs": {"url": "https://example.com/a_b"}},
+			 {"type": "embedCard", "attrs": {"url": "https://example.com/embed", "layout": "wide"}},
+			 {"type": "blockCard", "attrs": {"data": {}}}`,
+			"[https://example.com/a\\_b](https://example.com/a_b)\n\n[https://example.com/embed](https://example.com/embed)",
+		},
+		{
+			"extension",
+			`{"type": "paragraph", "content": [{"type": "text", "text": "Contents:"}]},
+			 {"type": "extension", "attrs": {"extensionType": "com.atlassian.confluence.macro.core", "extensionKey": "toc"}}`,
+			"Contents:",
+		},
+		{
+			"layout and bodied extension fall back to their content",
+			`{"type": "layoutSection", "content": [
+				{"type": "layoutColumn", "attrs": {"width": 50}, "content": [{"type": "paragraph", "content": [{"type": "text", "text": "left"}]}]},
+				{"type": "layoutColumn", "attrs": {"width": 50}, "content": [
+					{"type": "bodiedExtension", "attrs": {"extensionKey": "details"}, "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "right"}]}
+					]}
+				]}
+			]}`,
+			"left\n\nright",
+		},
+		{
+			"unknown block with inline content",
+			`{"type": "somethingNew", "content": [{"type": "text", "text": " hello "}, {"type": "text", "text": "there", "marks": [{"type": "strong"}]}]}`,
+			"hello **there**",
+		},
+		{
+			"unknown node without content",
+			`{"type": "paragraph", "content": [{"type": "text", "text": "before"}]},
+			 {"type": "somethingNew", "attrs": {"x": 1}},
+			 {"type": "paragraph", "content": [{"type": "text", "text": "after"}]}`,
+			"before\n\nafter",
+		},
+		{
+			"inline nodes",
+			`{"type": "paragraph", "content": [
+				{"type": "text", "text": "line"}, {"type": "hardBreak"}, {"type": "text", "text": "break "},
+				{"type": "mention", "attrs": {"id": "557058:abc", "text": "@Jane_Doe"}}, {"type": "text", "text": " "},
+				{"type": "emoji", "attrs": {"shortName": ":tada:", "text": "🎉"}},
+				{"type": "emoji", "attrs": {"shortName": ":custom:"}}, {"type": "text", "text": " "},
+				{"type": "date", "attrs": {"timestamp": "1709294400000"}}, {"type": "text", "text": " "},
+				{"type": "status", "attrs": {"text": "IN PROGRESS", "color": "blue"}}, {"type": "text", "text": " "},
+				{"type": "inlineCard", "attrs": {"url": "https://example.com/x"}},
+				{"type": "placeholder", "attrs": {"text": "Type here"}},
+				{"type": "inlineExtension", "attrs": {"extensionKey": "anchor"}},
+				{"type": "somethingInline", "content": [{"type": "text", "text": " unknown"}]}
+			]}`,
+			"line\\\nbreak @Jane\\_Doe 🎉:custom: 2024-03-01 `IN PROGRESS` [https://example.com/x](https://example.com/x) unknown",
+		},
+		{
+			"bad date",
+			`{"type": "paragraph", "content": [{"type": "text", "text": "on "}, {"type": "date", "attrs": {"timestamp": "soon"}}]}`,
+			"on",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(t, &Renderer{}, tt.content); got != tt.want {
+				t.Errorf("Render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarks(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		marks string
+		want  string
+	}{
+		{"none", "a_b", ``, "a\\_b"},
+		{"strong", "bold", `{"type": "strong"}`, "**bold**"},
+		{"em", "italic", `{"type": "em"}`, "*italic*"},
+		{"strike", "gone", `{"type": "strike"}`, "~~gone~~"},
+		{"sub", "2", `{"type": "subsup", "attrs": {"type": "sub"}}`, "<sub>2</sub>"},
+		{"sup", "2", `{"type": "subsup", "attrs": {"type": "sup"}}`, "<sup>2</sup>"},
+		{"code", "a_b*", `{"type": "code"}`, "`a_b*`"},
+		{"code with backticks", "`x`", `{"type": "code"}`, "`` `x` ``"},
+		{"link", "docs", `{"type": "link", "attrs": {"href": "https://example.com/a b"}}`, "[docs](https://example.com/a%20b)"},
+		{"underline and colour are dropped", "plain", `{"type": "underline"}, {"type": "textColor", "attrs": {"color": "#ff0000"}}`, "plain"},
+		{"unknown mark", "plain", `{"type": "somethingNew"}`, "plain"},
+		{"whitespace stays outside", " spaced ", `{"type": "strong"}`, "**spaced**"},
+		{"nested", "all", `{"type": "link", "attrs": {"href": "https://example.com"}}, {"type": "em"}, {"type": "strong"}, {"type": "code"}`, "[***`all`***](https://example.com)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `{"type": "paragraph", "content": [{"type": "text", "text": "` + tt.text + `", "marks": [` + tt.marks + `]}]}`
+			if got := render(t, &Renderer{}, content); got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHooks(t *testing.T) {
+	r := &Renderer{
+		LinkURL: func(href string) string {
+			return strings.Replace(href, "https://acme.atlassian.net/wiki/spaces/SPC/pages/200/Other", "../200-other.md", 1)
+		},
+		MediaURL: func(media Node) string {
+			if media.Attr("id") == "file-1" {
+				return "100-page/attachments/diagram one.png"
+			}
+			return ""
+		},
+		Mention: func(id string, text string) string {
+			return "@Jane Doe <" + id + ">"
+		},
+		Panel: func(panelType string, body string) string {
+			return ":::" + panelType + "\n\n" + body + "\n\n:::"
+		},
+	}
+
+	content := `{"type": "paragraph", "content": [
+			{"type": "text", "text": "see", "marks": [{"type": "link", "attrs": {"href": "https://acme.atlassian.net/wiki/spaces/SPC/pages/200/Other"}}]},
+			{"type": "text", "text": " or "},
+			{"type": "inlineCard", "attrs": {"url": "https://acme.atlassian.net/wiki/spaces/SPC/pages/200/Other"}},
+			{"type": "text", "text": ", "},
+			{"type": "mention", "attrs": {"id": "abc", "text": ""}}
+		]},
+		{"type": "mediaSingle", "content": [{"type": "media", "attrs": {"type": "file", "id": "file-1", "alt": "diagram"}}]},
+		{"type": "mediaSingle", "content": [{"type": "media", "attrs": {"type": "file", "id": "file-2", "alt": "lost"}}]},
+		{"type": "panel", "attrs": {"panelType": "info"}, "content": [{"type": "paragraph", "content": [{"type": "text", "text": "FYI"}]}]}`
+
+	want := strings.Join([]string{
+		"[see](../200-other.md) or [https://acme.atlassian.net/wiki/spaces/SPC/pages/200/Other](../200-other.md), @Jane Doe <abc>",
+		"![diagram](100-page/attachments/diagram%20one.png)",
+		"*lost*",
+		":::info\n\nFYI\n\n:::",
+	}, "\n\n")
+	if got := render(t, r, content); got != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"doc", `{"type": "doc", "version": 1, "content": []}`, false},
+		{"not a doc", `{"type": "paragraph", "content": []}`, true},
+		{"not JSON", `<p>hello</p>`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttr(t *testing.T) {
+	n := Node{Attrs: map[string]any{"s": "text", "f": 2.5, "i": float64(3), "b": true, "o": map[string]any{}}}
+	for name, want := range map[string]string{"s": "text", "f": "2.5", "i": "3", "b": "true", "o": "", "missing": ""} {
+		if got := n.Attr(name); got != want {
+			t.Errorf("Attr(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -27,6 +27,8 @@ var showCmd = &cobra.Command{
 
 		fmt.Printf("  Config file: %s\n", Config)
 		fmt.Printf("  Debug: %v\n", Debug)
+		fmt.Printf("  LogFormat: %s\n", LogFormat)
+		fmt.Printf("  LogLevel: %s\n", LogLevel)
 		fmt.Println()
 		fmt.Printf("  Parsed YAML:\n%#v\n", ParsedConfig)
 		fmt.Println()
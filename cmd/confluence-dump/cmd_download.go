@@ -5,14 +5,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"runtime"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
@@ -41,13 +45,19 @@ download (of course, if this is the first time you're running confluence-dump, e
 get downloaded).
 4. Once the download is complete, all Markdown files in your local store that we _haven't_
 downloaded or skipped will be assumed stale (e.g., they got moved, or are now deleted).  These files
-will be deleted.  This only happens for spaces we scraped, so if your store has space A & B but this
-time your ran with --spaces=A, we won't touch B's files at all.
+will be moved to the trash (see 'confluence-dump trash').  This only happens for spaces we scraped,
+so if your store has space A & B but this time your ran with --spaces=A, we won't touch B's files at
+all.
+
+If a download is interrupted (say, with Ctrl-C) after listing the spaces, we give the requests in
+flight a few seconds to finish and save a checkpoint in the store.  Run again with --resume to skip
+the listing and the pages that were already done.
 
 Example invocation:
 
 $ confluence-dump --spaces=CORE,DRE
 $ confluence-dump --all-spaces # Disregards your configured list of spaces
+$ confluence-dump --resume     # Continue an interrupted run
 `)
 
 var downloadCmd = &cobra.Command{
@@ -95,6 +105,38 @@ var (
 	IncludeArchived  bool
 	IncludePersonal  bool
 
+	MaxRPS   float64
+	MaxBurst int
+
+	MaxAttempts int
+	MaxBackoff  time.Duration
+
+	KeepGoing     bool
+	FailureReport string
+	Report        string
+
+	SlugStyle       string
+	AdmonitionStyle string
+	BodyFormat      string
+	MentionEmail    bool
+	RelativeLinks   bool
+	Attachments     bool
+
+	Incremental      bool
+	FullSyncInterval time.Duration
+	FullSync         bool
+
+	Resume     bool
+	Quarantine bool
+
+	TrashRetention time.Duration
+
+	PruneThreshold float64
+	ForcePrune     bool
+	PruneDryRun    bool
+
+	GitCommit bool
+
 	Spaces []string
 
 	PostDownloadCmd []string
@@ -113,6 +155,29 @@ func init() {
 	downloadCmd.Flags().BoolVar(&IncludeArchived, "include-archived", false, "include archived content")
 	downloadCmd.Flags().BoolVar(&IncludeBlogposts, "include-blogposts", false, "download blogposts as well as usual posts")
 	downloadCmd.Flags().BoolVar(&IncludePersonal, "include-personal-spaces", false, "download pages from individuals' personal spaces")
+	downloadCmd.Flags().Float64Var(&MaxRPS, "max-rps", 10, "maximum API requests per second across all workers (0 for unlimited)")
+	downloadCmd.Flags().IntVar(&MaxBurst, "max-burst", 10, "number of API requests allowed in a burst above --max-rps")
+	downloadCmd.Flags().IntVar(&MaxAttempts, "max-attempts", localdump.DefaultRetryPolicy.MaxAttempts, "how many times to try a request that failed with a transient error")
+	downloadCmd.Flags().BoolVar(&KeepGoing, "keep-going", false, "don't abort when individual pages fail; summarise failures at the end")
+	downloadCmd.Flags().StringVar(&FailureReport, "failure-report", "", "with --keep-going, write failed pages as JSON to this file")
+	downloadCmd.Flags().StringVar(&Report, "report", "", "write what happened to every page, and per-phase timings, as JSON to this file")
+	downloadCmd.Flags().BoolVar(&MentionEmail, "mention-email", false, "write @mentions with the user's email address, e.g. \"@Jane Doe (jane@example.com)\"")
+	downloadCmd.Flags().StringVar(&BodyFormat, "body-format", string(localdump.BodyView), "which page bodies to convert: view (rendered HTML), storage (Confluence's XHTML, keeps macros and links intact) or atlas_doc_format (the editor's JSON)")
+	downloadCmd.Flags().StringVar(&AdmonitionStyle, "admonition-style", string(localdump.AdmonitionGitHub), "how to write info/note/warning/tip panels: github, mkdocs or docusaurus")
+	downloadCmd.Flags().StringVar(&SlugStyle, "slug-style", string(localdump.SlugASCII), "how to turn titles into filenames: ascii (transliterate) or unicode (keep letters of any script)")
+	downloadCmd.Flags().BoolVar(&RelativeLinks, "relative-links", true, "rewrite links to other Confluence pages into relative links within the local store")
+	downloadCmd.Flags().BoolVar(&Attachments, "attachments", false, "download page attachments and images, and link to the local copies")
+	downloadCmd.Flags().BoolVar(&Incremental, "incremental", false, "only list pages changed since the last sync, using CQL search")
+	downloadCmd.Flags().DurationVar(&FullSyncInterval, "full-sync-interval", localdump.DefaultFullSyncInterval, "with --incremental, do a full listing anyway if the last one is older than this")
+	downloadCmd.Flags().BoolVar(&FullSync, "full", false, "with --incremental, do a full listing this time")
+	downloadCmd.Flags().Float64Var(&PruneThreshold, "prune-threshold", localdump.DefaultPruneThreshold, "refuse to prune more than this percentage of a space's pages (0 for no limit)")
+	downloadCmd.Flags().BoolVar(&ForcePrune, "force-prune", false, "prune even if that exceeds --prune-threshold")
+	downloadCmd.Flags().BoolVar(&PruneDryRun, "prune-dry-run", false, "don't prune, but print which files would be pruned and why")
+	downloadCmd.Flags().BoolVar(&GitCommit, "git-commit", false, "commit the store to git after downloading, summarising what changed")
+	downloadCmd.Flags().DurationVar(&TrashRetention, "trash-retention", localdump.DefaultTrashRetention, "how long to keep pruned files in the trash (0 to keep them forever)")
+	downloadCmd.Flags().BoolVar(&Quarantine, "quarantine", true, "move local Markdown files we can't parse out of the way, rather than aborting")
+	downloadCmd.Flags().BoolVar(&Resume, "resume", false, "continue an interrupted run from its checkpoint")
+	downloadCmd.Flags().DurationVar(&MaxBackoff, "max-backoff", localdump.DefaultRetryPolicy.MaxDelay, "longest pause between retries of a failed request")
 
 	downloadCmd.PersistentFlags().StringSliceVar(&Spaces, "spaces", []string{}, "list of spaces to scrape")
 	downloadCmd.PersistentFlags().StringSliceVar(&PostDownloadCmd, "post-download-cmd", []string{}, "command to execute after download")
@@ -121,12 +186,27 @@ func init() {
 func runDownload(ctx context.Context) error {
 	start := time.Now()
 
-	log := log.New(os.Stderr, "[confluence-dump] ", 0)
+	log := slog.Default()
 
 	if LocalStore == "" {
 		return fmt.Errorf("download: no location for local store; use --store or set in config file")
 	}
 
+	slugStyle, err := localdump.ParseSlugStyle(SlugStyle)
+	if err != nil {
+		return fmt.Errorf("download: invalid --slug-style: %w", err)
+	}
+
+	admonitionStyle, err := localdump.ParseAdmonitionStyle(AdmonitionStyle)
+	if err != nil {
+		return fmt.Errorf("download: invalid --admonition-style: %w", err)
+	}
+
+	bodyFormat, err := localdump.ParseBodyFormat(BodyFormat)
+	if err != nil {
+		return fmt.Errorf("download: invalid --body-format: %w", err)
+	}
+
 	storePath, err := homedir.Expand(LocalStore)
 	if err != nil {
 		return fmt.Errorf("download: couldn't expand homedir: %w", err)
@@ -134,7 +214,7 @@ func runDownload(ctx context.Context) error {
 
 	storePathInfo, err := os.Stat(storePath)
 	if os.IsNotExist(err) {
-		log.Printf("Store '%s' doesn't exist, creating.\n", storePath)
+		log.Info("Store doesn't exist, creating", "path", storePath)
 		if err := os.Mkdir(storePath, os.FileMode(0755)); err != nil {
 			return fmt.Errorf("download: failed to create directory %s: %w", storePath, err)
 		}
@@ -150,19 +230,9 @@ func runDownload(ctx context.Context) error {
 		return fmt.Errorf("localdump: couldn't create directory %s: %w", storePathWithOrg, err)
 	}
 
-	tokenCmdOutput, err := exec.Command(AuthTokenCmd[0], AuthTokenCmd[1:]...).Output()
+	api, err := newConfluenceAPI()
 	if err != nil {
-		return fmt.Errorf("download: couldn't execute auth-token-cmd '%v': %w", AuthTokenCmd, err)
-	}
-
-	token := strings.Split(string(tokenCmdOutput), "\n")[0]
-
-	api, err := confluence.NewAPI(
-		ConfluenceInstance,
-		AuthUsername,
-		token)
-	if err != nil {
-		return fmt.Errorf("download: couldn't instantiate Confluence API: %w", err)
+		return err
 	}
 
 	if WithVCR {
@@ -192,8 +262,8 @@ func runDownload(ctx context.Context) error {
 		api.Client = vcrClient
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	ctx, stop := cancelOnInterrupt(ctx, log)
+	defer stop()
 
 	// get current user information
 	currentUser, err := api.CurrentUser(ctx)
@@ -201,15 +271,118 @@ func runDownload(ctx context.Context) error {
 		return fmt.Errorf("download: couldn't query current user: %w", err)
 	}
 
-	log.Printf("Logged in to id.atlassian.com as '%s (%s)'...\n", currentUser.DisplayName, currentUser.Email)
+	log.Info("Logged in to id.atlassian.com", "name", currentUser.DisplayName, "email", currentUser.Email)
+
+	spacesToDownload, err := selectSpaces(ctx, api, log)
+	if err != nil {
+		return err
+	}
+
+	for _, space := range spacesToDownload {
+		log.Info("Enqueuing for download", "space", space.Key, "name", space.Name)
+	}
+
+	if AllSpaces && len(Spaces) > 0 {
+		log.Warn("🚨 Both --all-spaces && --spaces set, ignoring --spaces")
+	}
+
+	downloader := localdump.SpacesDownloader{
+		StorePath:       storePath,
+		Workers:         runtime.NumCPU(),
+		Logger:          log,
+		AlwaysDownload:  AlwaysDownload,
+		API:             api,
+		HideProgress:    LogFormat == LogFormatJSON,
+		WriteMarkdown:   WriteMarkdown,
+		Prune:           Prune,
+		IncludeArchived: IncludeArchived,
+		IncludePersonal: IncludePersonal,
+		Retry: localdump.RetryPolicy{
+			MaxAttempts: MaxAttempts,
+			BaseDelay:   localdump.DefaultRetryPolicy.BaseDelay,
+			MaxDelay:    MaxBackoff,
+		},
+		KeepGoing:       KeepGoing,
+		SlugStyle:       slugStyle,
+		AdmonitionStyle: admonitionStyle,
+		BodyFormat:      bodyFormat,
+		MentionEmail:    MentionEmail,
+		RelativeLinks:   RelativeLinks,
+		Attachments:     Attachments,
+
+		Incremental:      Incremental,
+		FullSyncInterval: FullSyncInterval,
+		ForceFullSync:    FullSync,
+
+		Resume:         Resume,
+		Quarantine:     Quarantine,
+		TrashRetention: TrashRetention,
+		PruneThreshold: PruneThreshold,
+		ForcePrune:     ForcePrune,
+		PruneDryRun:    PruneDryRun,
+
+		GitCommit: GitCommit,
+	}
+
+	downloadErr := downloader.DownloadConfluenceSpaces(ctx, spacesToDownload)
+	if PruneDryRun {
+		printPrunePlans(downloader.PrunePlans())
+	}
+	if failures := downloader.Failures(); len(failures) > 0 {
+		printFailures(failures)
+		if FailureReport != "" {
+			if err := writeFailureReport(FailureReport, failures); err != nil {
+				return fmt.Errorf("download: couldn't write failure report: %w", err)
+			}
+			log.Info("Wrote failure report", "path", FailureReport)
+		}
+	}
+	if Report != "" {
+		if err := writeReport(Report, downloader.Report()); err != nil {
+			return fmt.Errorf("download: couldn't write report: %w", err)
+		}
+		log.Info("Wrote report", "path", Report)
+	}
+	if downloadErr != nil {
+		return fmt.Errorf("download: Couldn't download spaces: %w", downloadErr)
+	}
+
+	duration := time.Since(start)
+	log.Info("Finished", "duration", duration)
+
+	return nil
+}
+
+func newConfluenceAPI() (*confluence.API, error) {
+	tokenCmdOutput, err := exec.Command(AuthTokenCmd[0], AuthTokenCmd[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("download: couldn't execute auth-token-cmd '%v': %w", AuthTokenCmd, err)
+	}
+
+	token := strings.Split(string(tokenCmdOutput), "\n")[0]
+
+	api, err := confluence.NewAPI(
+		ConfluenceInstance,
+		AuthUsername,
+		token)
+	if err != nil {
+		return nil, fmt.Errorf("download: couldn't instantiate Confluence API: %w", err)
+	}
+	api.SetRateLimit(MaxRPS, MaxBurst)
+	api.Logger = slog.Default()
 
+	return api, nil
+}
+
+// selectSpaces resolves --spaces, --all-spaces and --include-blogposts into the spaces to work on.
+func selectSpaces(ctx context.Context, api *confluence.API, log *slog.Logger) ([]confluence.Space, error) {
 	// list all spaces:
-	log.Println("Listing Confluence spaces...")
+	log.Info("Listing Confluence spaces")
 	spacesRemote, err := api.ListAllSpaces(ctx, ConfluenceInstance, IncludePersonal)
 	if err != nil {
-		return fmt.Errorf("download: couldn't list Confluence spaces: %w", err)
+		return nil, fmt.Errorf("download: couldn't list Confluence spaces: %w", err)
 	}
-	log.Printf("Found %d spaces on '%s'.\n", len(spacesRemote), ConfluenceInstance)
+	log.Info("Listed Confluence spaces", "spaces", len(spacesRemote), "instance", ConfluenceInstance)
 
 	spacesToDownload := []confluence.Space{}
 	if AllSpaces {
@@ -220,7 +393,7 @@ func runDownload(ctx context.Context) error {
 		for _, requestedSpace := range Spaces {
 			sp, ok := spacesRemote[requestedSpace]
 			if !ok {
-				return fmt.Errorf("download: requested space %s does not exist", requestedSpace)
+				return nil, fmt.Errorf("download: requested space %s does not exist", requestedSpace)
 			}
 			spacesToDownload = append(spacesToDownload, sp)
 		}
@@ -239,37 +412,99 @@ func runDownload(ctx context.Context) error {
 	}
 
 	if len(spacesToDownload) == 0 {
-		return fmt.Errorf("cmd_download: no spaces selected, nothing to do")
+		return nil, fmt.Errorf("cmd_download: no spaces selected, nothing to do")
 	}
 
-	log.Println("Enqueuing for download:")
-	for _, space := range spacesToDownload {
-		log.Printf("  - %s: %s\n", space.Key, space.Name)
+	return spacesToDownload, nil
+}
+
+// cancelOnInterrupt gives you a context that's cancelled on the first SIGINT or SIGTERM, so we can
+// wind down and save a checkpoint.  The second one kills us the usual way.
+func cancelOnInterrupt(ctx context.Context, log *slog.Logger) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-interrupts:
+			log.Warn("Interrupted!  Giving requests in flight a few seconds to finish; interrupt again to quit right away")
+			signal.Stop(interrupts)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(interrupts)
+		cancel()
 	}
+}
 
-	if AllSpaces && len(Spaces) > 0 {
-		log.Println("🚨 WARNING: Both --all-spaces && --spaces set, ignoring --spaces.")
+func printPrunePlans(plans []localdump.PrunePlan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, plan := range plans {
+		fmt.Fprintf(w, "\n%s: would prune %d of %d pages", plan.Space.Key, plan.PrunedPages(), plan.Pages)
+		if plan.Refused {
+			fmt.Fprint(w, " (exceeds --prune-threshold)")
+		}
+		fmt.Fprintln(w)
+		if len(plan.Candidates) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(w, "\nREASON\tFILE\tNOW AT")
+		for _, c := range plan.Candidates {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Reason, c.Path, c.NewPath)
+		}
 	}
+	fmt.Fprintln(w)
+	w.Flush()
+}
 
-	downloader := localdump.SpacesDownloader{
-		StorePath:       storePath,
-		Workers:         runtime.NumCPU(),
-		Logger:          log,
-		AlwaysDownload:  AlwaysDownload,
-		API:             api,
-		Debug:           Debug,
-		WriteMarkdown:   WriteMarkdown,
-		Prune:           Prune,
-		IncludeArchived: IncludeArchived,
-		IncludePersonal: IncludePersonal,
+func printFailures(failures []localdump.PageFailure) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	pages, attachments := localdump.CountFailures(failures)
+	fmt.Fprintf(w, "\n%d page(s) and %d attachment(s) failed:\n\n", pages, attachments)
+	fmt.Fprintln(w, "SPACE\tID\tPAGE\tTITLE\tERROR")
+	for _, f := range failures {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.SpaceKey, f.ID, f.Page, f.Title, f.Error)
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+}
+
+func writeFailureReport(filename string, failures []localdump.PageFailure) error {
+	expanded, err := homedir.Expand(filename)
+	if err != nil {
+		return fmt.Errorf("download: couldn't expand homedir: %w", err)
 	}
 
-	if err := downloader.DownloadConfluenceSpaces(ctx, spacesToDownload); err != nil {
-		return fmt.Errorf("download: Couldn't download spaces: %w", err)
+	report, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("download: couldn't marshal failures: %w", err)
 	}
 
-	duration := time.Since(start)
-	log.Printf("Finished in %s!\n", duration)
+	if err := os.WriteFile(expanded, append(report, '\n'), 0644); err != nil {
+		return fmt.Errorf("download: couldn't write %s: %w", expanded, err)
+	}
+	return nil
+}
 
+func writeReport(filename string, report localdump.Report) error {
+	expanded, err := homedir.Expand(filename)
+	if err != nil {
+		return fmt.Errorf("download: couldn't expand homedir: %w", err)
+	}
+
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("download: couldn't marshal report: %w", err)
+	}
+
+	if err := os.WriteFile(expanded, append(contents, '\n'), 0644); err != nil {
+		return fmt.Errorf("download: couldn't write %s: %w", expanded, err)
+	}
 	return nil
 }
@@ -0,0 +1,109 @@
+/*
+Copyright © 2024 paul <paul@denknerd.org>
+*/
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/toothbrush/confluence-dump/localdump"
+)
+
+var fsckUsage = strings.TrimSpace(`
+Check the local store for trouble, without talking to Confluence.  We look for:
+
+- files claiming the same Confluence ID (which 'download' refuses to deal with),
+- files whose front matter we can't parse,
+- pages that aren't where their ancestry says they should be (according to our local copies, and
+  your current slug-style),
+- pages whose ancestors we don't have, and
+- directories that don't belong to any page, or are empty.
+
+With --fix, we sort out what we can.  Of duplicates, the one with the lower version goes to the
+trash.  Broken files are moved to .confluence-dump/quarantine/.  Misplaced pages are moved where they
+belong, attachments and all (their relative links are only updated when they're next downloaded;
+use 'download --always-download' if you're impatient).  Attachments whose page is gone go to the
+trash, and empty directories are removed.
+
+Example invocation:
+
+$ confluence-dump fsck
+$ confluence-dump fsck --fix
+`)
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check the local store for consistency",
+	Long:  fsckUsage,
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storePath, err := expandedStorePath()
+		if err != nil {
+			return err
+		}
+
+		slugStyle, err := localdump.ParseSlugStyle(SlugStyle)
+		if err != nil {
+			return fmt.Errorf("fsck: invalid --slug-style: %w", err)
+		}
+
+		downloader := localdump.SpacesDownloader{
+			StorePath: storePath,
+			Logger:    slog.Default(),
+			SlugStyle: slugStyle,
+		}
+
+		issues, err := downloader.Fsck(FsckFix)
+		printFsckIssues(issues)
+		if err != nil {
+			return fmt.Errorf("fsck: %w", err)
+		}
+
+		unfixed := 0
+		for _, issue := range issues {
+			if !issue.Fixed {
+				unfixed++
+			}
+		}
+		if unfixed > 0 {
+			return fmt.Errorf("fsck: %d problem(s) remaining", unfixed)
+		}
+		return nil
+	},
+}
+
+var FsckFix bool
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().BoolVar(&FsckFix, "fix", false, "resolve the problems we find, where we can")
+	fsckCmd.Flags().StringVar(&SlugStyle, "slug-style", string(localdump.SlugASCII), "how titles are turned into filenames: ascii or unicode")
+}
+
+func printFsckIssues(issues []localdump.FsckIssue) {
+	if len(issues) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PROBLEM\tPATH\tDETAIL\tFIXED")
+	for _, issue := range issues {
+		detail := issue.Detail
+		if issue.Problem == localdump.FsckMisplaced {
+			detail = strings.TrimSpace(fmt.Sprintf("should be %s %s", issue.ExpectedPath, detail))
+		}
+		fixed := ""
+		if issue.Fixed {
+			fixed = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Problem, issue.Path, detail, fixed)
+	}
+	w.Flush()
+}
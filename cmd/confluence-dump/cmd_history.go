@@ -0,0 +1,139 @@
+/*
+Copyright © 2024 paul <paul@denknerd.org>
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/toothbrush/confluence-dump/localdump"
+)
+
+var historyUsage = strings.TrimSpace(`
+Replay the full version history of Confluence pages into a git repository.
+
+For the given spaces, this fetches every version of every page, oldest first, converts each one to
+Markdown, and commits it with the original author, timestamp and version message.  That gets you
+'git log' and 'git blame' over your wiki.  Pages are kept where they live now, even if they were
+called something else back then.
+
+The history goes into its own repository, given by --output (which is created if need be), not into
+your usual store.  Running this again only adds the versions that aren't in there yet.  Fair warning:
+this is one request per version, so a space with a long history takes a while.
+
+Example invocation:
+
+$ confluence-dump history --spaces=CORE --output=~/confluence-history
+`)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Export every version of pages as git commits",
+	Long:  historyUsage,
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistory(cmd.Context())
+	},
+}
+
+var HistoryOutput string
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringVar(&HistoryOutput, "output", "", "git repository to replay the history into")
+	historyCmd.Flags().BoolVar(&AllSpaces, "all-spaces", false, "export all spaces")
+	historyCmd.Flags().StringSliceVar(&Spaces, "spaces", []string{}, "list of spaces to export")
+	historyCmd.Flags().BoolVar(&IncludeArchived, "include-archived", false, "include archived content")
+	historyCmd.Flags().BoolVar(&IncludeBlogposts, "include-blogposts", false, "export blogposts as well as usual posts")
+	historyCmd.Flags().BoolVar(&IncludePersonal, "include-personal-spaces", false, "export pages from individuals' personal spaces")
+	historyCmd.Flags().Float64Var(&MaxRPS, "max-rps", 10, "maximum API requests per second across all workers (0 for unlimited)")
+	historyCmd.Flags().IntVar(&MaxBurst, "max-burst", 10, "number of API requests allowed in a burst above --max-rps")
+	historyCmd.Flags().IntVar(&MaxAttempts, "max-attempts", localdump.DefaultRetryPolicy.MaxAttempts, "how many times to try a request that failed with a transient error")
+	historyCmd.Flags().DurationVar(&MaxBackoff, "max-backoff", localdump.DefaultRetryPolicy.MaxDelay, "longest pause between retries of a failed request")
+	historyCmd.Flags().BoolVar(&MentionEmail, "mention-email", false, "write @mentions with the user's email address, e.g. \"@Jane Doe (jane@example.com)\"")
+	historyCmd.Flags().StringVar(&BodyFormat, "body-format", string(localdump.BodyView), "which page bodies to convert: view (rendered HTML), storage (Confluence's XHTML, keeps macros and links intact) or atlas_doc_format (the editor's JSON)")
+	historyCmd.Flags().StringVar(&AdmonitionStyle, "admonition-style", string(localdump.AdmonitionGitHub), "how to write info/note/warning/tip panels: github, mkdocs or docusaurus")
+	historyCmd.Flags().StringVar(&SlugStyle, "slug-style", string(localdump.SlugASCII), "how to turn titles into filenames: ascii (transliterate) or unicode (keep letters of any script)")
+	historyCmd.Flags().BoolVar(&RelativeLinks, "relative-links", true, "rewrite links to other Confluence pages into relative links within the repository")
+	historyCmd.MarkFlagRequired("output")
+}
+
+func runHistory(ctx context.Context) error {
+	start := time.Now()
+
+	log := slog.Default()
+
+	slugStyle, err := localdump.ParseSlugStyle(SlugStyle)
+	if err != nil {
+		return fmt.Errorf("history: invalid --slug-style: %w", err)
+	}
+
+	admonitionStyle, err := localdump.ParseAdmonitionStyle(AdmonitionStyle)
+	if err != nil {
+		return fmt.Errorf("history: invalid --admonition-style: %w", err)
+	}
+
+	bodyFormat, err := localdump.ParseBodyFormat(BodyFormat)
+	if err != nil {
+		return fmt.Errorf("history: invalid --body-format: %w", err)
+	}
+
+	outputPath, err := homedir.Expand(HistoryOutput)
+	if err != nil {
+		return fmt.Errorf("history: couldn't expand homedir: %w", err)
+	}
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return fmt.Errorf("history: failed to create directory %s: %w", outputPath, err)
+	}
+
+	api, err := newConfluenceAPI()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := cancelOnInterrupt(ctx, log)
+	defer stop()
+
+	spaces, err := selectSpaces(ctx, api, log)
+	if err != nil {
+		return err
+	}
+
+	downloader := localdump.SpacesDownloader{
+		StorePath:       outputPath,
+		Workers:         runtime.NumCPU(),
+		Logger:          log,
+		API:             api,
+		HideProgress:    LogFormat == LogFormatJSON,
+		WriteMarkdown:   true,
+		IncludeArchived: IncludeArchived,
+		IncludePersonal: IncludePersonal,
+		Retry: localdump.RetryPolicy{
+			MaxAttempts: MaxAttempts,
+			BaseDelay:   localdump.DefaultRetryPolicy.BaseDelay,
+			MaxDelay:    MaxBackoff,
+		},
+		SlugStyle:       slugStyle,
+		AdmonitionStyle: admonitionStyle,
+		BodyFormat:      bodyFormat,
+		MentionEmail:    MentionEmail,
+		RelativeLinks:   RelativeLinks,
+		Quarantine:      true,
+	}
+
+	if err := downloader.ExportHistory(ctx, spaces); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	log.Info("Finished", "duration", time.Since(start))
+	return nil
+}
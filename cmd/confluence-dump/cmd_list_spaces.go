@@ -6,8 +6,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"os/exec"
+	"log/slog"
 	"sort"
 	"strings"
 
@@ -28,22 +27,13 @@ var listSpacesCmd = &cobra.Command{
 		ctx, cancel := context.WithCancel(cmd.Context())
 		defer cancel()
 
-		tokenCmdOutput, err := exec.Command(AuthTokenCmd[0], AuthTokenCmd[1:]...).Output()
+		api, err := newConfluenceAPI()
 		if err != nil {
-			return fmt.Errorf("download: couldn't execute auth-token-cmd '%v': %w", AuthTokenCmd, err)
-		}
-
-		token := strings.Split(string(tokenCmdOutput), "\n")[0]
-		api, err := confluence.NewAPI(
-			ConfluenceInstance,
-			AuthUsername,
-			token)
-		if err != nil {
-			return fmt.Errorf("download: couldn't instantiate Confluence API: %w", err)
+			return err
 		}
 
 		// list all spaces:
-		log.Printf("Listing Confluence spaces in %s...\n", ConfluenceInstance)
+		slog.Info("Listing Confluence spaces", "instance", ConfluenceInstance)
 		spacesRemote, err := api.ListAllSpaces(ctx, ConfluenceInstance, IncludePersonal)
 		if err != nil {
 			return fmt.Errorf("download: couldn't list Confluence spaces: %w", err)
@@ -56,7 +46,7 @@ var listSpacesCmd = &cobra.Command{
 			Org:  ConfluenceInstance,
 		}
 
-		log.Printf("Found %d spaces on '%s'.\n", len(spacesRemote), ConfluenceInstance)
+		slog.Info("Listed Confluence spaces", "spaces", len(spacesRemote), "instance", ConfluenceInstance)
 
 		spaceKeys := []string{}
 
@@ -81,4 +71,6 @@ func init() {
 	listCmd.AddCommand(listSpacesCmd)
 
 	listSpacesCmd.Flags().BoolVar(&IncludePersonal, "include-personal-spaces", false, "list individuals' personal spaces")
+	listSpacesCmd.Flags().Float64Var(&MaxRPS, "max-rps", 10, "maximum API requests per second (0 for unlimited)")
+	listSpacesCmd.Flags().IntVar(&MaxBurst, "max-burst", 10, "number of API requests allowed in a burst above --max-rps")
 }
@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 paul <paul@denknerd.org>
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/toothbrush/confluence-dump/localdump"
+)
+
+var pruneUsage = strings.TrimSpace(`
+Prune the local store without downloading anything.
+
+This lists the pages in the given spaces, just like 'download' does, and then moves files of pages
+that no longer exist on Confluence to the trash, along with Markdown files we don't recognise.
+Pages that merely moved are left alone: the next download will move them.  The same
+--prune-threshold applies as for downloads.
+
+Example invocation:
+
+$ confluence-dump prune --spaces=CORE --dry-run
+`)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove local copies of pages deleted from Confluence",
+	Long:  pruneUsage,
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPrune(cmd.Context())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().BoolVar(&AllSpaces, "all-spaces", false, "prune all spaces")
+	pruneCmd.Flags().StringSliceVar(&Spaces, "spaces", []string{}, "list of spaces to prune")
+	pruneCmd.Flags().BoolVar(&IncludeArchived, "include-archived", false, "keep archived content")
+	pruneCmd.Flags().BoolVar(&IncludeBlogposts, "include-blogposts", false, "prune blogposts as well as usual posts")
+	pruneCmd.Flags().BoolVar(&IncludePersonal, "include-personal-spaces", false, "consider individuals' personal spaces")
+	pruneCmd.Flags().Float64Var(&MaxRPS, "max-rps", 10, "maximum API requests per second across all workers (0 for unlimited)")
+	pruneCmd.Flags().IntVar(&MaxBurst, "max-burst", 10, "number of API requests allowed in a burst above --max-rps")
+	pruneCmd.Flags().StringVar(&SlugStyle, "slug-style", string(localdump.SlugASCII), "how titles are turned into filenames: ascii or unicode")
+	pruneCmd.Flags().Float64Var(&PruneThreshold, "prune-threshold", localdump.DefaultPruneThreshold, "refuse to prune more than this percentage of a space's pages (0 for no limit)")
+	pruneCmd.Flags().BoolVar(&ForcePrune, "force-prune", false, "prune even if that exceeds --prune-threshold")
+	pruneCmd.Flags().BoolVar(&PruneDryRun, "dry-run", false, "don't prune, but print which files would be pruned and why")
+	pruneCmd.Flags().BoolVar(&Quarantine, "quarantine", true, "move local Markdown files we can't parse out of the way, rather than pruning them")
+	pruneCmd.Flags().DurationVar(&TrashRetention, "trash-retention", localdump.DefaultTrashRetention, "how long to keep pruned files in the trash (0 to keep them forever)")
+}
+
+func runPrune(ctx context.Context) error {
+	log := slog.Default()
+
+	storePath, err := expandedStorePath()
+	if err != nil {
+		return err
+	}
+
+	slugStyle, err := localdump.ParseSlugStyle(SlugStyle)
+	if err != nil {
+		return fmt.Errorf("prune: invalid --slug-style: %w", err)
+	}
+
+	api, err := newConfluenceAPI()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	spaces, err := selectSpaces(ctx, api, log)
+	if err != nil {
+		return err
+	}
+
+	downloader := localdump.SpacesDownloader{
+		StorePath:       storePath,
+		Workers:         runtime.NumCPU(),
+		Logger:          log,
+		API:             api,
+		HideProgress:    LogFormat == LogFormatJSON,
+		WriteMarkdown:   !PruneDryRun,
+		Quarantine:      Quarantine,
+		Prune:           true,
+		IncludeArchived: IncludeArchived,
+		IncludePersonal: IncludePersonal,
+		SlugStyle:       slugStyle,
+
+		TrashRetention: TrashRetention,
+		PruneThreshold: PruneThreshold,
+		ForcePrune:     ForcePrune,
+		PruneDryRun:    PruneDryRun,
+	}
+
+	pruneErr := downloader.PruneSpaces(ctx, spaces)
+	if PruneDryRun {
+		printPrunePlans(downloader.PrunePlans())
+	}
+	if pruneErr != nil {
+		return fmt.Errorf("prune: %w", pruneErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2024 paul <paul@denknerd.org>
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/toothbrush/confluence-dump/localdump"
+)
+
+var statusUsage = strings.TrimSpace(`
+Show what a download would change, without downloading anything.
+
+This lists the pages in the given spaces, just like 'download' does, and compares them to the local
+store.  For each space, we print the pages that are new, that were edited since we downloaded them,
+that would move (say, because an ancestor was renamed), and the files that would be pruned.  No page
+bodies are fetched and the store isn't touched.
+
+Example invocation:
+
+$ confluence-dump status --spaces=CORE,DRE
+$ confluence-dump status --spaces=CORE --json | jq '.[].pages[] | select(.status == "updated")'
+`)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show what a download would change",
+	Long:  statusUsage,
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStatus(cmd.Context())
+	},
+}
+
+var StatusJSON bool
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&StatusJSON, "json", false, "print the status as JSON")
+	statusCmd.Flags().BoolVar(&AllSpaces, "all-spaces", false, "consider all spaces")
+	statusCmd.Flags().StringSliceVar(&Spaces, "spaces", []string{}, "list of spaces to consider")
+	statusCmd.Flags().BoolVar(&IncludeArchived, "include-archived", false, "include archived content")
+	statusCmd.Flags().BoolVar(&IncludeBlogposts, "include-blogposts", false, "consider blogposts as well as usual posts")
+	statusCmd.Flags().BoolVar(&IncludePersonal, "include-personal-spaces", false, "consider individuals' personal spaces")
+	statusCmd.Flags().Float64Var(&MaxRPS, "max-rps", 10, "maximum API requests per second across all workers (0 for unlimited)")
+	statusCmd.Flags().IntVar(&MaxBurst, "max-burst", 10, "number of API requests allowed in a burst above --max-rps")
+	statusCmd.Flags().StringVar(&SlugStyle, "slug-style", string(localdump.SlugASCII), "how titles are turned into filenames: ascii or unicode")
+	statusCmd.Flags().Float64Var(&PruneThreshold, "prune-threshold", localdump.DefaultPruneThreshold, "refuse to prune more than this percentage of a space's pages (0 for no limit)")
+}
+
+func runStatus(ctx context.Context) error {
+	log := slog.Default()
+
+	storePath, err := expandedStorePath()
+	if err != nil {
+		return err
+	}
+
+	slugStyle, err := localdump.ParseSlugStyle(SlugStyle)
+	if err != nil {
+		return fmt.Errorf("status: invalid --slug-style: %w", err)
+	}
+
+	api, err := newConfluenceAPI()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	spaces, err := selectSpaces(ctx, api, log)
+	if err != nil {
+		return err
+	}
+
+	downloader := localdump.SpacesDownloader{
+		StorePath:       storePath,
+		Workers:         runtime.NumCPU(),
+		Logger:          log,
+		API:             api,
+		HideProgress:    LogFormat == LogFormatJSON,
+		IncludeArchived: IncludeArchived,
+		IncludePersonal: IncludePersonal,
+		SlugStyle:       slugStyle,
+		PruneThreshold:  PruneThreshold,
+	}
+
+	status, err := downloader.Status(ctx, spaces)
+	if err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+
+	if StatusJSON {
+		out, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("status: couldn't marshal status: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	printStatus(status)
+	return nil
+}
+
+func printStatus(spaces []localdump.SpaceStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, space := range spaces {
+		counts := make(map[localdump.StatusKind]int)
+		for _, page := range space.Pages {
+			counts[page.Status]++
+		}
+		fmt.Fprintf(w, "\n%s: %d new, %d updated, %d moved, %d to prune, %d unchanged",
+			space.Space,
+			counts[localdump.StatusNew],
+			counts[localdump.StatusUpdated],
+			counts[localdump.StatusMoved],
+			counts[localdump.StatusPrune],
+			space.Unchanged)
+		if space.PruneRefused {
+			fmt.Fprint(w, " (pruning exceeds --prune-threshold)")
+		}
+		fmt.Fprintln(w)
+		if len(space.Pages) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(w, "\nSTATUS\tVERSION\tPATH\tDETAIL")
+		for _, page := range space.Pages {
+			version := ""
+			detail := ""
+			switch page.Status {
+			case localdump.StatusNew:
+				version = fmt.Sprintf("v%d", page.RemoteVersion)
+			case localdump.StatusUpdated:
+				version = fmt.Sprintf("v%d -> v%d", page.LocalVersion, page.RemoteVersion)
+				if page.OldPath != page.NewPath {
+					detail = fmt.Sprintf("from %s", page.OldPath)
+				}
+			case localdump.StatusMoved:
+				version = fmt.Sprintf("v%d", page.RemoteVersion)
+				detail = fmt.Sprintf("from %s", page.OldPath)
+			case localdump.StatusPrune:
+				detail = string(page.Reason)
+			}
+			path := page.NewPath
+			if path == "" {
+				path = page.OldPath
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", page.Status, version, path, detail)
+		}
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+}
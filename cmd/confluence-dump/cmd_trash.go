@@ -0,0 +1,139 @@
+/*
+Copyright © 2024 paul <paul@denknerd.org>
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/toothbrush/confluence-dump/localdump"
+)
+
+var trashUsage = strings.TrimSpace(`
+When a download prunes files from your store (because they were moved or deleted on Confluence), we
+don't delete them straight away: they're moved to .confluence-dump/trash/ in your store, into a
+directory per run, keeping their paths.  Commands in this namespace let you look at, restore or
+empty the trash.  Old trash is also emptied automatically after 'trash-retention'.
+`)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Commands to manage pruned files",
+	Long:  trashUsage,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pruned files, by run",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storePath, err := expandedStorePath()
+		if err != nil {
+			return err
+		}
+
+		batches, err := localdump.ListTrash(storePath)
+		if err != nil {
+			return fmt.Errorf("trash: couldn't list trash: %w", err)
+		}
+		if len(batches) == 0 {
+			fmt.Println("The trash is empty.")
+			return nil
+		}
+
+		for _, batch := range batches {
+			fmt.Printf("%s (pruned %s, %d files)\n", batch.Name, batch.Time.Local().Format(time.DateTime), len(batch.Files))
+			if TrashVerbose {
+				for _, file := range batch.Files {
+					fmt.Printf("  %s\n", file)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore BATCH",
+	Short: "Move the files pruned in a run back into the store",
+	Long: strings.TrimSpace(`
+Move the files pruned in a run (see 'trash list') back where they came from.  Files that have since
+been written again are left in the trash.  Bear in mind that if a page was pruned because it moved,
+restoring it gives you two files with the same ID, and the next download will complain about that.
+`),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storePath, err := expandedStorePath()
+		if err != nil {
+			return err
+		}
+
+		restored, skipped, err := localdump.RestoreTrash(storePath, args[0])
+		for _, file := range restored {
+			fmt.Printf("Restored: %s\n", file)
+		}
+		for _, file := range skipped {
+			fmt.Printf("Skipped, exists: %s\n", file)
+		}
+		if err != nil {
+			return fmt.Errorf("trash: couldn't restore %s: %w", args[0], err)
+		}
+		return nil
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete pruned files",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storePath, err := expandedStorePath()
+		if err != nil {
+			return err
+		}
+
+		emptied, err := localdump.EmptyTrash(storePath, TrashOlderThan, time.Now())
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, batch := range emptied {
+			fmt.Fprintf(w, "Deleted %s\t(%d files)\n", batch.Name, len(batch.Files))
+		}
+		w.Flush()
+		if err != nil {
+			return fmt.Errorf("trash: couldn't empty trash: %w", err)
+		}
+		return nil
+	},
+}
+
+var (
+	TrashVerbose   bool
+	TrashOlderThan time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+	trashCmd.AddCommand(trashEmptyCmd)
+
+	trashListCmd.Flags().BoolVarP(&TrashVerbose, "verbose", "v", false, "list every file")
+	trashEmptyCmd.Flags().DurationVar(&TrashOlderThan, "older-than", 0, "only delete files pruned longer ago than this")
+}
+
+func expandedStorePath() (string, error) {
+	if LocalStore == "" {
+		return "", fmt.Errorf("confluence-dump: no location for local store; use --store or set in config file")
+	}
+
+	storePath, err := homedir.Expand(LocalStore)
+	if err != nil {
+		return "", fmt.Errorf("confluence-dump: couldn't expand homedir: %w", err)
+	}
+	return storePath, nil
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"reflect"
 	"strings"
@@ -22,6 +23,9 @@ var (
 	Config string
 	Debug  bool
 
+	LogFormat string
+	LogLevel  string
+
 	// Command to run to retrieve API Personal Access Token
 	AuthTokenCmd []string
 
@@ -50,6 +54,12 @@ var rootCmd = &cobra.Command{
 			return fmt.Errorf("confluence-dump: failed to initialise config: %w", err)
 		}
 
+		logger, err := newLogger(os.Stderr, LogFormat, LogLevel, Debug)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+
 		if len(AuthTokenCmd) < 1 {
 			return fmt.Errorf("confluence-dump: please provide --auth-token-cmd")
 		}
@@ -60,7 +70,9 @@ var rootCmd = &cobra.Command{
 func init() {
 	// Define cobra flags, the default value has the lowest (least significant) precedence
 	rootCmd.PersistentFlags().StringVar(&Config, "config", "", "config file location (default: ~/.config/confluence-dump.yaml, respects CONFLUENCE_DUMP_CONFIG)")
-	rootCmd.PersistentFlags().BoolVar(&Debug, "debug", false, "display debug output")
+	rootCmd.PersistentFlags().BoolVar(&Debug, "debug", false, "display debug output, same as --log-level=debug")
+	rootCmd.PersistentFlags().StringVar(&LogFormat, "log-format", LogFormatText, "how to write log lines: text or json")
+	rootCmd.PersistentFlags().StringVar(&LogLevel, "log-level", "info", "least severe log lines to write: debug, info, warn or error")
 	rootCmd.PersistentFlags().StringSliceVar(&AuthTokenCmd, "auth-token-cmd", []string{}, "shell command to retrieve Atlassian auth token")
 	rootCmd.PersistentFlags().StringVar(&LocalStore, "store", "", "location to save Confluence pages")
 	rootCmd.PersistentFlags().StringVar(&AuthUsername, "auth-username", "", "your Atlassian username")
@@ -117,12 +129,34 @@ type YamlConfig struct {
 	IncludePersonal  *bool `yaml:"include-personal-spaces"`
 	WriteMarkdown    *bool `yaml:"write-markdown"`
 	Prune            *bool `yaml:"prune"`
+	KeepGoing        *bool `yaml:"keep-going"`
+	RelativeLinks    *bool `yaml:"relative-links"`
+	Attachments      *bool `yaml:"attachments"`
+	Incremental      *bool `yaml:"incremental"`
+	Quarantine       *bool `yaml:"quarantine"`
+	GitCommit        *bool `yaml:"git-commit"`
+	MentionEmail     *bool `yaml:"mention-email"`
+
+	MaxRPS         *float64 `yaml:"max-rps"`
+	MaxBurst       *int     `yaml:"max-burst"`
+	MaxAttempts    *int     `yaml:"max-attempts"`
+	PruneThreshold *float64 `yaml:"prune-threshold"`
 
 	StorePath          string   `yaml:"store"`
 	ConfluenceInstance string   `yaml:"confluence-instance"`
 	AuthUsername       string   `yaml:"auth-username"`
 	AuthTokenCmd       []string `yaml:"auth-token-cmd"`
 	Spaces             []string `yaml:"spaces"`
+	MaxBackoff         string   `yaml:"max-backoff"`
+	FailureReport      string   `yaml:"failure-report"`
+	Report             string   `yaml:"report"`
+	SlugStyle          string   `yaml:"slug-style"`
+	AdmonitionStyle    string   `yaml:"admonition-style"`
+	BodyFormat         string   `yaml:"body-format"`
+	FullSyncInterval   string   `yaml:"full-sync-interval"`
+	TrashRetention     string   `yaml:"trash-retention"`
+	LogFormat          string   `yaml:"log-format"`
+	LogLevel           string   `yaml:"log-level"`
 
 	PostDownloadCmd []string `yaml:"post-download-cmd"`
 }
@@ -143,14 +177,23 @@ func bindFlags(cmd *cobra.Command, v YamlConfig) error {
 		if !cmd.Flags().Changed(key) {
 			switch field.Kind() {
 			case reflect.Ptr:
-				// err, this is crappy, but i know YamlConfig only uses pointers for bools.....
-				b, ok := field.Value().(*bool)
-				if !ok {
+				// YamlConfig uses pointers for scalars, so we can tell "unset" from the zero value.
+				switch v := field.Value().(type) {
+				case *bool:
+					if v != nil {
+						cmd.Flags().Set(key, fmt.Sprintf("%v", *v))
+					}
+				case *int:
+					if v != nil {
+						cmd.Flags().Set(key, fmt.Sprintf("%d", *v))
+					}
+				case *float64:
+					if v != nil {
+						cmd.Flags().Set(key, fmt.Sprintf("%v", *v))
+					}
+				default:
 					return fmt.Errorf("confluence-dump: found unrecognised field: %+v", field)
 				}
-				if b != nil {
-					cmd.Flags().Set(key, fmt.Sprintf("%v", *b))
-				}
 
 			case reflect.String:
 				s, ok := field.Value().(string)
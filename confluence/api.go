@@ -2,8 +2,14 @@ package confluence
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 func NewAPI(instance string, username string, token string) (*API, error) {
@@ -28,9 +34,10 @@ func NewAPI(instance string, username string, token string) (*API, error) {
 	}
 
 	a := &API{
-		BaseURI:  u,
-		token:    token,
-		username: username,
+		BaseURI:            u,
+		MaxThrottleRetries: 5,
+		token:              token,
+		username:           username,
 	}
 	a.Client = &http.Client{}
 
@@ -44,6 +51,44 @@ type API struct {
 	// An HTTP client - you can substitute VCR or whatnot.
 	Client *http.Client
 
+	// How many times a single request may be throttled (HTTP 429 or 503) before we give up on it.
+	MaxThrottleRetries int
+
 	// Auth info
 	username, token string
+
+	// Client-side budget shared by everything using this API; nil means unlimited.
+	limiter *rate.Limiter
+
+	// When Confluence asks us to back off, every request holds off until this moment.
+	throttleMu    sync.Mutex
+	throttleUntil time.Time
+
+	// How many HTTP requests we've sent, retries included.
+	requests atomic.Int64
+
+	// Where requests are logged, at debug level; nil means slog's default.
+	Logger *slog.Logger
+}
+
+func (api *API) logger() *slog.Logger {
+	if api.Logger == nil {
+		return slog.Default()
+	}
+	return api.Logger
+}
+
+// Requests returns the number of HTTP requests this API has sent so far, retries included.
+func (api *API) Requests() int64 {
+	return api.requests.Load()
+}
+
+// SetRateLimit caps the number of requests per second this API will make, across all goroutines
+// using it, allowing short bursts of up to `burst` requests.  A non-positive rps removes the limit.
+func (api *API) SetRateLimit(rps float64, burst int) {
+	if rps <= 0 {
+		api.limiter = nil
+		return
+	}
+	api.limiter = rate.NewLimiter(rate.Limit(rps), max(burst, 1))
 }
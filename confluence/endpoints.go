@@ -3,6 +3,7 @@ package confluence
 import (
 	"fmt"
 	"net/url"
+	"path"
 
 	"github.com/google/go-querystring/query"
 )
@@ -124,6 +125,93 @@ func (a *API) getPagesEndpoint(opts GetPagesQuery) (*url.URL, error) {
 	return ep, nil
 }
 
+// getAttachmentsEndpoint returns the (v2) API endpoint to list a page's or blog post's attachments:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-attachment/#api-pages-id-attachments-get
+func (a *API) getAttachmentsEndpoint(opts GetAttachmentsQuery) (*url.URL, error) {
+	if opts.ID < 1 {
+		return nil, fmt.Errorf("confluence: please provide ID to list attachments")
+	}
+
+	collection := "pages"
+	if opts.ContentType == BlogContent {
+		collection = "blogposts"
+	}
+
+	ep, err := a.resolveEndpoint(fmt.Sprintf("/wiki/api/v2/%s/%d/attachments", collection, opts.ID))
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't resolve endpoint: %w", err)
+	}
+
+	v, err := query.Values(opts)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't encode query params: %w", err)
+	}
+	ep.RawQuery = v.Encode()
+
+	return ep, nil
+}
+
+// getPageVersionsEndpoint returns the (v2) API endpoint to list a page's or blog post's versions:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-version/#api-pages-id-versions-get
+func (a *API) getPageVersionsEndpoint(opts GetPageVersionsQuery) (*url.URL, error) {
+	if opts.ID < 1 {
+		return nil, fmt.Errorf("confluence: please provide ID to list versions")
+	}
+
+	collection := "pages"
+	if opts.ContentType == BlogContent {
+		collection = "blogposts"
+	}
+
+	ep, err := a.resolveEndpoint(fmt.Sprintf("/wiki/api/v2/%s/%d/versions", collection, opts.ID))
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't resolve endpoint: %w", err)
+	}
+
+	v, err := query.Values(opts)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't encode query params: %w", err)
+	}
+	ep.RawQuery = v.Encode()
+
+	return ep, nil
+}
+
+// getAttachmentDownloadEndpoint returns the URL to download an attachment's contents.  The API
+// gives us that relative to the /wiki base.
+func (a *API) getAttachmentDownloadEndpoint(attachment Attachment) (*url.URL, error) {
+	link := attachment.DownloadLink
+	if link == "" {
+		link = attachment.Links.Download
+	}
+	if link == "" {
+		return nil, fmt.Errorf("confluence: attachment %s has no download link", attachment.ID)
+	}
+
+	return a.resolveEndpoint(path.Join(a.BaseURI.Path, link))
+}
+
+// getContentSearchEndpoint returns the (v1, but supported) API endpoint to search content with CQL:
+// https://developer.atlassian.com/cloud/confluence/rest/v1/api-group-content/#api-wiki-rest-api-content-search-get
+func (a *API) getContentSearchEndpoint(opts SearchContentQuery) (*url.URL, error) {
+	if opts.CQL == "" {
+		return nil, fmt.Errorf("confluence: please provide CQL to search content")
+	}
+
+	ep, err := a.resolveEndpoint("/wiki/rest/api/content/search")
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't resolve endpoint: %w", err)
+	}
+
+	v, err := query.Values(opts)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't encode query params: %w", err)
+	}
+	ep.RawQuery = v.Encode()
+
+	return ep, nil
+}
+
 // getSpaceEndpoint returns the (v2) API endpoint to list spaces
 // https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-space/#api-spaces-get
 func (a *API) getSpaceEndpoint(opts SpacesQuery) (*url.URL, error) {
@@ -0,0 +1,172 @@
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIError is returned whenever Confluence answers with a non-success HTTP status.  Use errors.As
+// to get at it, or one of the Is* helpers below.
+type APIError struct {
+	StatusCode int
+	Status     string // e.g. "404 Not Found"
+	Method     string
+	Endpoint   string
+
+	// Atlassian's trace ID for this request, handy when talking to their support.
+	RequestID string
+
+	// Decoded from the response body, if Confluence sent us something we understand.  The v2 API
+	// returns a list of Errors, the v1 API a single Message.
+	Errors  []ErrorDetail
+	Message string
+
+	// If we were throttled, how long Confluence asked us to wait.
+	RetryAfter time.Duration
+}
+
+// ErrorDetail is one entry of the v2 API's error response:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/intro/#status-codes
+type ErrorDetail struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+func newAPIError(req *http.Request, response *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Method:     req.Method,
+		Endpoint:   req.URL.String(),
+		RequestID:  response.Header.Get("Atl-Traceid"),
+	}
+	if e.RequestID == "" {
+		e.RequestID = response.Header.Get("X-Request-Id")
+	}
+
+	var decoded struct {
+		Errors  []ErrorDetail `json:"errors"`
+		Message string        `json:"message"`
+	}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		e.Errors = decoded.Errors
+		e.Message = decoded.Message
+	} else if text := strings.TrimSpace(string(body)); text != "" && !strings.HasPrefix(text, "<") {
+		// some errors (e.g. from the auth layer) come back as plain text.  HTML error pages aren't
+		// worth repeating, though.
+		if len(text) > 200 {
+			text = text[:200] + "…"
+		}
+		e.Message = text
+	}
+
+	return e
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("confluence: %s %s: %s", e.Method, e.Endpoint, e.Status)
+
+	details := []string{}
+	if e.Message != "" {
+		details = append(details, e.Message)
+	}
+	for _, d := range e.Errors {
+		if d.Detail != "" {
+			details = append(details, fmt.Sprintf("%s: %s", d.Title, d.Detail))
+		} else if d.Title != "" {
+			details = append(details, d.Title)
+		}
+	}
+	if len(details) > 0 {
+		msg += ": " + strings.Join(details, "; ")
+	}
+
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (asked to retry in %s)", e.RetryAfter)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID %s)", e.RequestID)
+	}
+
+	return msg
+}
+
+// Is lets errors.Is(err, ErrRateLimited) match throttling responses.
+func (e *APIError) Is(target error) bool {
+	return target == ErrRateLimited && e.throttled()
+}
+
+func (e *APIError) throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// IsNotFound reports whether err means the requested object doesn't exist (anymore).
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound, http.StatusGone)
+}
+
+// IsForbidden reports whether err means we aren't allowed to see the requested object.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsUnauthorized reports whether err means our credentials were rejected.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsRateLimited reports whether err means Confluence throttled us.
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// IsRetryable reports whether it's worth trying the request behind err again: throttling, server
+// hiccups, timeouts and network trouble are; anything else the server told us about isn't.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// transport-level failures (connection reset, DNS, TLS, ...) come wrapped in a *url.Error.
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+func hasStatus(err error, codes ...int) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
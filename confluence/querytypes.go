@@ -53,6 +53,24 @@ type GetPageByIDQuery struct {
 	Version    int    `url:"version,omitempty"` // Allows you to retrieve a previously published version. Specify the previous version's number to retrieve its details.
 }
 
+// GetPageVersionsQuery defines the query parameters for:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-version/#api-pages-id-versions-get
+//
+// Blog posts have the same shape of endpoint:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-version/#api-blogposts-id-versions-get
+type GetPageVersionsQuery struct {
+	ID          int         `url:"-"` // ID of the page or blog post; required
+	ContentType ContentType `url:"-"` // whether ID is a page or a blog post
+
+	Sort string `url:"sort,omitempty"` // Sort order: modified-date, -modified-date
+
+	// 'Cursor' is used for pagination; this opaque cursor will be returned in the 'next' URL in the
+	// 'Link' response header.  Use the relative URL in the 'Link' header to retrieve the next set
+	// of results.
+	Cursor string `url:"cursor,omitempty"`
+	Limit  int    `url:"limit,omitempty"` // page limit; default 50, range 1-250
+}
+
 // GetUserByIDQuery defines the query parameters for v1 query:
 // https://developer.atlassian.com/cloud/confluence/rest/v1/api-group-users/#api-wiki-rest-api-user-get
 type GetUserByIDQuery struct {
@@ -68,3 +86,39 @@ type GetFolderByIDQuery struct {
 	IncludeOperations     bool `url:"include-operations,omitempty"`
 	IncludeProperties     bool `url:"include-properties,omitempty"`
 }
+
+// GetAttachmentsQuery defines the query parameters for:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-attachment/#api-pages-id-attachments-get
+//
+// Blog posts have the same shape of endpoint:
+// https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-attachment/#api-blogposts-id-attachments-get
+type GetAttachmentsQuery struct {
+	ID          int         `url:"-"` // ID of the page or blog post; required
+	ContentType ContentType `url:"-"` // whether ID is a page or a blog post
+
+	// Filter the results to attachments based on...
+	Status    []string `url:"status,omitempty,comma"` // their status: current, archived, trashed
+	MediaType string   `url:"mediatype,omitempty"`    // their media type, e.g. image/png
+	Filename  string   `url:"filename,omitempty"`     // their file name
+
+	Sort string `url:"sort,omitempty"` // Sort order: created-date, -created-date, modified-date, -modified-date
+
+	// 'Cursor' is used for pagination; this opaque cursor will be returned in the 'next' URL in the
+	// 'Link' response header.  Use the relative URL in the 'Link' header to retrieve the next set
+	// of results.
+	Cursor string `url:"cursor,omitempty"`
+	Limit  int    `url:"limit,omitempty"` // page limit; default 50, range 1-250
+}
+
+// SearchContentQuery defines the query parameters for the (v1, but there's no v2 equivalent yet)
+// CQL content search:
+// https://developer.atlassian.com/cloud/confluence/rest/v1/api-group-content/#api-wiki-rest-api-content-search-get
+type SearchContentQuery struct {
+	CQL    string   `url:"cql"`                    // e.g. space = "DRE" and lastmodified >= "2024-01-31 13:37"
+	Expand []string `url:"expand,omitempty,comma"` // e.g. version, ancestors, space, history
+
+	// 'Cursor' is used for pagination; this opaque cursor will be returned in the 'next' URL in the
+	// '_links' of the response.
+	Cursor string `url:"cursor,omitempty"`
+	Limit  int    `url:"limit,omitempty"` // page limit; default 25
+}
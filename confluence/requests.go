@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 func (api *API) GetUserByID(ctx context.Context, opts GetUserByIDQuery) (*User, error) {
@@ -127,10 +128,10 @@ func (api *API) GetPages(ctx context.Context, opts GetPagesQuery) (*MultiPageRes
 	return &pageList, nil
 }
 
-func (api *API) getSpaces(ctx context.Context, opts SpacesQuery) (*AllSpaces, error) {
-	ep, err := api.getSpaceEndpoint(opts)
+func (api *API) GetAttachments(ctx context.Context, opts GetAttachmentsQuery) (*MultiAttachmentResponse, error) {
+	ep, err := api.getAttachmentsEndpoint(opts)
 	if err != nil {
-		return nil, fmt.Errorf("confluence: couldn't get spaces endpoint: %w", err)
+		return nil, fmt.Errorf("confluence: couldn't get attachments endpoint: %w", err)
 	}
 
 	body, err := api.request(ctx, ep)
@@ -138,77 +139,186 @@ func (api *API) getSpaces(ctx context.Context, opts SpacesQuery) (*AllSpaces, er
 		return nil, fmt.Errorf("confluence: couldn't perform request: %w", err)
 	}
 
-	var allSpaces AllSpaces
+	var attachmentList MultiAttachmentResponse
 
-	if err := json.Unmarshal(body, &allSpaces); err != nil {
+	if err := json.Unmarshal(body, &attachmentList); err != nil {
 		return nil, fmt.Errorf("confluence: couldn't parse json response: %w", err)
 	}
 
-	return &allSpaces, nil
+	return &attachmentList, nil
 }
 
-// CurrentUser return current user information
-func (api *API) CurrentUser(ctx context.Context) (*User, error) {
-	ep, err := api.getCurrentUserEndpoint()
+// GetPageVersions lists (one page of) the versions of a page or blog post.
+func (api *API) GetPageVersions(ctx context.Context, opts GetPageVersionsQuery) (*MultiVersionResponse, error) {
+	ep, err := api.getPageVersionsEndpoint(opts)
 	if err != nil {
-		return nil, fmt.Errorf("confluence: couldn't get current user endpoint: %w", err)
+		return nil, fmt.Errorf("confluence: couldn't get versions endpoint: %w", err)
 	}
 
 	body, err := api.request(ctx, ep)
 	if err != nil {
-		return nil, fmt.Errorf("confluence: couldn't perform http request: %w", err)
+		return nil, fmt.Errorf("confluence: couldn't perform request: %w", err)
 	}
 
-	var user User
-	if err := json.Unmarshal(body, &user); err != nil {
+	var versionList MultiVersionResponse
+
+	if err := json.Unmarshal(body, &versionList); err != nil {
 		return nil, fmt.Errorf("confluence: couldn't parse json response: %w", err)
 	}
 
-	return &user, nil
+	return &versionList, nil
 }
 
-// Request implements the basic Request function
-func (api *API) request(ctx context.Context, url *url.URL) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+// DownloadAttachment returns the raw contents of an attachment.
+func (api *API) DownloadAttachment(ctx context.Context, attachment Attachment) ([]byte, error) {
+	ep, err := api.getAttachmentDownloadEndpoint(attachment)
 	if err != nil {
-		return nil, fmt.Errorf("confluence: couldn't instantiate http request: %w", err)
+		return nil, fmt.Errorf("confluence: couldn't get attachment download endpoint: %w", err)
 	}
 
-	req.Header.Add("Accept", "application/json, */*")
+	body, err := api.request(ctx, ep)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't perform request: %w", err)
+	}
 
-	// if user & token are not set, do not add authorization header
-	if api.username != "" && api.token != "" {
-		req.SetBasicAuth(api.username, api.token)
-	} else if api.token != "" {
-		req.Header.Set("Authorization", "Bearer "+api.token)
+	return body, nil
+}
+
+// SearchContent finds pages and blog posts matching a CQL query.
+func (api *API) SearchContent(ctx context.Context, opts SearchContentQuery) (*ContentSearchResponse, error) {
+	ep, err := api.getContentSearchEndpoint(opts)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't get content search endpoint: %w", err)
 	}
 
-	response, err := api.Client.Do(req)
+	body, err := api.request(ctx, ep)
 	if err != nil {
-		return nil, fmt.Errorf("confluence: couldn't perform http request: %w", err)
+		return nil, fmt.Errorf("confluence: couldn't perform request: %w", err)
+	}
+
+	var searchResults ContentSearchResponse
+
+	if err := json.Unmarshal(body, &searchResults); err != nil {
+		return nil, fmt.Errorf("confluence: couldn't parse json response: %w", err)
+	}
+
+	return &searchResults, nil
+}
+
+func (api *API) getSpaces(ctx context.Context, opts SpacesQuery) (*AllSpaces, error) {
+	ep, err := api.getSpaceEndpoint(opts)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't get spaces endpoint: %w", err)
 	}
 
-	body, err := io.ReadAll(response.Body)
+	body, err := api.request(ctx, ep)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't perform request: %w", err)
+	}
+
+	var allSpaces AllSpaces
+
+	if err := json.Unmarshal(body, &allSpaces); err != nil {
+		return nil, fmt.Errorf("confluence: couldn't parse json response: %w", err)
+	}
+
+	return &allSpaces, nil
+}
+
+// CurrentUser return current user information
+func (api *API) CurrentUser(ctx context.Context) (*User, error) {
+	ep, err := api.getCurrentUserEndpoint()
 	if err != nil {
-		return nil, fmt.Errorf("confluence: couldn't read http response body: %w", err)
+		return nil, fmt.Errorf("confluence: couldn't get current user endpoint: %w", err)
 	}
 
-	if err := response.Body.Close(); err != nil {
-		return nil, fmt.Errorf("confluence: couldn't close response body: %w", err)
+	body, err := api.request(ctx, ep)
+	if err != nil {
+		return nil, fmt.Errorf("confluence: couldn't perform http request: %w", err)
 	}
 
-	switch response.StatusCode {
-	case http.StatusOK, http.StatusCreated, http.StatusPartialContent, http.StatusNoContent, http.StatusResetContent:
-		return body, nil
-	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("confluence: authentication failed")
-	case http.StatusServiceUnavailable:
-		return nil, fmt.Errorf("confluence: service is not available: %s", response.Status)
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("confluence: internal server error: %s", response.Status)
-	case http.StatusConflict:
-		return nil, fmt.Errorf("confluence: conflict: %s", response.Status)
+	var user User
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, fmt.Errorf("confluence: couldn't parse json response: %w", err)
 	}
 
-	return nil, fmt.Errorf("confluence: unknown HTTP response status: %s: %s", response.Status, url.String())
+	return &user, nil
+}
+
+// Request implements the basic Request function.  If Confluence throttles us (HTTP 429 or 503), all
+// requests back off for as long as we're told to, and this request is retried.
+func (api *API) request(ctx context.Context, url *url.URL) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := api.WaitForThrottle(ctx); err != nil {
+			return nil, fmt.Errorf("confluence: gave up waiting for rate limit: %w", err)
+		}
+		if api.limiter != nil {
+			if err := api.waitForBudget(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("confluence: couldn't instantiate http request: %w", err)
+		}
+
+		req.Header.Add("Accept", "application/json, */*")
+
+		// if user & token are not set, do not add authorization header
+		if api.username != "" && api.token != "" {
+			req.SetBasicAuth(api.username, api.token)
+		} else if api.token != "" {
+			req.Header.Set("Authorization", "Bearer "+api.token)
+		}
+
+		api.requests.Add(1)
+		sent := time.Now()
+		response, err := api.Client.Do(req)
+		if err != nil {
+			api.logger().DebugContext(ctx, "Request failed",
+				"method", req.Method, "url", req.URL.String(), "latency", time.Since(sent), "error", err)
+			return nil, fmt.Errorf("confluence: couldn't perform http request: %w", err)
+		}
+		api.logger().DebugContext(ctx, "Request",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"status", response.StatusCode,
+			"latency", time.Since(sent),
+			"attempt", attempt+1)
+
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("confluence: couldn't read http response body: %w", err)
+		}
+
+		if err := response.Body.Close(); err != nil {
+			return nil, fmt.Errorf("confluence: couldn't close response body: %w", err)
+		}
+
+		api.observeRateLimitHeaders(response.Header)
+
+		switch response.StatusCode {
+		case http.StatusOK, http.StatusCreated, http.StatusPartialContent, http.StatusNoContent, http.StatusResetContent:
+			return body, nil
+		}
+
+		apiErr := newAPIError(req, response, body)
+		if !apiErr.throttled() {
+			return nil, apiErr
+		}
+
+		delay := throttleDelay(response.Header, time.Now(), attempt)
+		resume := time.Now().Add(delay)
+		api.throttle(resume)
+
+		if attempt >= api.MaxThrottleRetries {
+			return nil, apiErr
+		}
+		if deadline, ok := ctx.Deadline(); ok && resume.After(deadline) {
+			// no point sleeping through our deadline, let the caller decide what to do.
+			apiErr.RetryAfter = delay
+			return nil, apiErr
+		}
+	}
 }
@@ -20,3 +20,34 @@ type MultiPageResponse struct {
 		Next string `json:"next"`
 	} `json:"_links"`
 }
+
+type MultiAttachmentResponse struct {
+	Results []Attachment `json:"results"`
+
+	Links struct {
+		// Contains the relative URL for the next set of results, using a cursor query
+		// parameter. This property will not be present if there is no additional data available.
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+type MultiVersionResponse struct {
+	Results []Version `json:"results"`
+
+	Links struct {
+		// Contains the relative URL for the next set of results, using a cursor query
+		// parameter. This property will not be present if there is no additional data available.
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+// ContentSearchResponse is what the v1 CQL content search returns.
+type ContentSearchResponse struct {
+	Results []Content `json:"results"`
+
+	Links struct {
+		// Contains the relative URL for the next set of results, using a cursor query
+		// parameter. This property will not be present if there is no additional data available.
+		Next string `json:"next"`
+	} `json:"_links"`
+}
@@ -2,12 +2,13 @@ package confluence
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
 )
 
-func (api API) ListAllSpaces(ctx context.Context, orgName string, includePersonal bool) (map[string]Space, error) {
+func (api *API) ListAllSpaces(ctx context.Context, orgName string, includePersonal bool) (map[string]Space, error) {
 	spaces := map[string]Space{}
 
 	query := SpacesQuery{
@@ -23,11 +24,14 @@ func (api API) ListAllSpaces(ctx context.Context, orgName string, includePersona
 	}
 
 	for {
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
-
-		allspaces, err := api.getSpaces(ctx, query)
-
+		allspaces, err := api.getSpacesWithTimeout(ctx, query)
+		if errors.Is(err, ErrRateLimited) {
+			// we're being throttled.  hold off, then ask for the same cursor again.
+			if err := api.WaitForThrottle(ctx); err != nil {
+				return nil, fmt.Errorf("confluence: couldn't list spaces: %w", err)
+			}
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("confluence: couldn't list spaces: %w", err)
 		}
@@ -59,3 +63,10 @@ func (api API) ListAllSpaces(ctx context.Context, orgName string, includePersona
 
 	return spaces, nil
 }
+
+func (api *API) getSpacesWithTimeout(ctx context.Context, query SpacesQuery) (*AllSpaces, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return api.getSpaces(ctx, query)
+}
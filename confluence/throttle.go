@@ -0,0 +1,135 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrRateLimited matches (via errors.Is) the *APIError returned when Confluence kept throttling a
+// request (HTTP 429 or 503), or when the requested backoff doesn't fit in the request's deadline.
+// The API remembers the backoff, so callers can WaitForThrottle and simply try again.
+var ErrRateLimited = errors.New("confluence: rate limited")
+
+const (
+	// Used when a throttled response doesn't tell us how long to wait.
+	defaultThrottleDelay = 2 * time.Second
+	maxThrottleDelay     = 5 * time.Minute
+)
+
+// WaitForThrottle blocks until any backoff Confluence asked for has elapsed, or ctx is done.
+func (api *API) WaitForThrottle(ctx context.Context) error {
+	for {
+		api.throttleMu.Lock()
+		wait := time.Until(api.throttleUntil)
+		api.throttleMu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			// loop around: somebody might have pushed throttleUntil further out meanwhile.
+		case <-ctx.Done():
+			timer.Stop()
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// waitForBudget blocks until the client-side limiter lets us send a request.  If it won't before
+// ctx's deadline, that's a throttle too: everybody holds off until it would, and we return
+// ErrRateLimited so the caller can WaitForThrottle and try again.
+func (api *API) waitForBudget(ctx context.Context) error {
+	r := api.limiter.Reserve()
+	if !r.OK() {
+		return fmt.Errorf("confluence: request budget can never allow this request")
+	}
+
+	delay := r.Delay()
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		r.Cancel()
+		api.throttle(time.Now().Add(delay))
+		return fmt.Errorf("%w: request budget exhausted for %s", ErrRateLimited, delay.Round(time.Millisecond))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return fmt.Errorf("confluence: gave up waiting for request budget: %w", context.Cause(ctx))
+	}
+}
+
+// throttle makes all requests hold off until at least `until`.
+func (api *API) throttle(until time.Time) {
+	api.throttleMu.Lock()
+	defer api.throttleMu.Unlock()
+
+	if until.After(api.throttleUntil) {
+		api.throttleUntil = until
+	}
+}
+
+// observeRateLimitHeaders pre-emptively backs off if a response tells us we've used up our budget.
+func (api *API) observeRateLimitHeaders(h http.Header) {
+	if h.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	if delay, ok := parseRateLimitReset(h.Get("X-RateLimit-Reset"), time.Now()); ok {
+		api.throttle(time.Now().Add(delay))
+	}
+}
+
+// throttleDelay works out how long to back off after a 429/503.  Retry-After wins, then
+// X-RateLimit-Reset, and if neither is present we back off exponentially.
+func throttleDelay(h http.Header, now time.Time, attempt int) time.Duration {
+	delay, ok := parseRetryAfter(h.Get("Retry-After"), now)
+	if !ok {
+		delay, ok = parseRateLimitReset(h.Get("X-RateLimit-Reset"), now)
+	}
+	if !ok {
+		delay = defaultThrottleDelay << min(attempt, 8)
+	}
+
+	return min(max(delay, 0), maxThrottleDelay)
+}
+
+// Retry-After is either a number of seconds, or an HTTP date:
+// https://www.rfc-editor.org/rfc/rfc9110#field.retry-after
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// Atlassian documents X-RateLimit-Reset as an ISO 8601 timestamp, but we'll also accept Unix
+// seconds, which is what most other APIs send:
+// https://developer.atlassian.com/cloud/confluence/rate-limiting/
+func parseRateLimitReset(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Sub(now), true
+	}
+	if epoch, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(epoch, 0).Sub(now), true
+	}
+	return 0, false
+}
@@ -0,0 +1,183 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		attempt int
+		want    time.Duration
+	}{
+		{"retry-after seconds", map[string]string{"Retry-After": "7"}, 0, 7 * time.Second},
+		{"retry-after date", map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)}, 0, 90 * time.Second},
+		{"retry-after wins over reset", map[string]string{"Retry-After": "3", "X-RateLimit-Reset": now.Add(time.Minute).Format(time.RFC3339)}, 0, 3 * time.Second},
+		{"reset as timestamp", map[string]string{"X-RateLimit-Reset": now.Add(time.Minute).Format(time.RFC3339)}, 0, time.Minute},
+		{"reset as epoch", map[string]string{"X-RateLimit-Reset": "1709294430"}, 0, 30 * time.Second},
+		{"retry-after in the past", map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}, 0, 0},
+		{"capped", map[string]string{"Retry-After": "3600"}, 0, maxThrottleDelay},
+		{"garbage falls back", map[string]string{"Retry-After": "soon"}, 0, defaultThrottleDelay},
+		{"no headers, first attempt", nil, 0, defaultThrottleDelay},
+		{"no headers, third attempt", nil, 2, 4 * defaultThrottleDelay},
+		{"no headers, many attempts", nil, 20, maxThrottleDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			if got := throttleDelay(h, now, tt.attempt); got != tt.want {
+				t.Errorf("throttleDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// throttlingServer answers the first `throttled` requests with `status` and the given headers, and
+// everything after that with "ok".
+func throttlingServer(t *testing.T, throttled int, status int, headers map[string]string) (*API, *url.URL, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(hits.Add(1)) <= throttled {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"message": "slow down"}`))
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/wiki/api/v2/pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &API{BaseURI: u, Client: srv.Client(), MaxThrottleRetries: 5}
+	return api, u, &hits
+}
+
+func TestRequestRetriesAfterRetryAfter(t *testing.T) {
+	api, u, hits := throttlingServer(t, 1, http.StatusTooManyRequests, map[string]string{"Retry-After": "1"})
+
+	start := time.Now()
+	body, err := api.request(context.Background(), u)
+	if err != nil {
+		t.Fatalf("request() failed: %v", err)
+	}
+	if string(body) != "ok" {
+		t.Errorf("request() = %q, want %q", body, "ok")
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("request() returned after %s, want it to have waited out Retry-After (1s)", elapsed)
+	}
+	if hits.Load() != 2 || api.Requests() != 2 {
+		t.Errorf("server saw %d requests, API counted %d, want 2", hits.Load(), api.Requests())
+	}
+}
+
+func TestRequestGivesUpWhenThrottled(t *testing.T) {
+	api, u, hits := throttlingServer(t, 100, http.StatusServiceUnavailable, map[string]string{
+		"X-RateLimit-Reset": time.Now().Add(time.Minute).UTC().Format(time.RFC3339),
+	})
+	api.MaxThrottleRetries = 0
+
+	before := time.Now()
+	_, err := api.request(context.Background(), u)
+	if !errors.Is(err, ErrRateLimited) || !IsRateLimited(err) {
+		t.Fatalf("request() = %v, want ErrRateLimited", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("request() = %v, want a 503 *APIError", err)
+	}
+	if apiErr.Message != "slow down" {
+		t.Errorf("APIError.Message = %q, want %q", apiErr.Message, "slow down")
+	}
+	if hits.Load() != 1 {
+		t.Errorf("server saw %d requests, want 1", hits.Load())
+	}
+
+	// everybody else should hold off until the reset, too.
+	if wait := api.throttleUntil.Sub(before); wait < 50*time.Second || wait > time.Minute+time.Second {
+		t.Errorf("throttled for %s, want about a minute", wait)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := api.WaitForThrottle(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForThrottle() = %v, want it to wait past our deadline", err)
+	}
+}
+
+func TestRequestDoesNotSleepThroughDeadline(t *testing.T) {
+	api, u, _ := throttlingServer(t, 100, http.StatusTooManyRequests, map[string]string{"Retry-After": "60"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := api.request(ctx, u)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("request() = %v, want a throttled *APIError", err)
+	}
+	if apiErr.RetryAfter != time.Minute {
+		t.Errorf("APIError.RetryAfter = %s, want 1m", apiErr.RetryAfter)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request() took %s, want it to give up straight away", elapsed)
+	}
+}
+
+func TestRateLimitHeadersThrottlePreemptively(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).UTC().Truncate(time.Second)
+	api, u, _ := throttlingServer(t, 1, http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     reset.Format(time.RFC3339),
+	})
+
+	if _, err := api.request(context.Background(), u); err != nil {
+		t.Fatalf("request() failed: %v", err)
+	}
+	if off := api.throttleUntil.Sub(reset).Abs(); off > time.Second {
+		t.Errorf("throttled until %s, want %s", api.throttleUntil, reset)
+	}
+}
+
+func TestExhaustedBudgetThrottlesEverybody(t *testing.T) {
+	api, u, hits := throttlingServer(t, 0, http.StatusOK, nil)
+	api.SetRateLimit(0.5, 1)
+
+	if _, err := api.request(context.Background(), u); err != nil {
+		t.Fatalf("first request() failed: %v", err)
+	}
+
+	// the next slot is two seconds away, which doesn't fit in our deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	before := time.Now()
+	if _, err := api.request(ctx, u); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("second request() = %v, want ErrRateLimited", err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("server saw %d requests, want 1", hits.Load())
+	}
+	if wait := api.throttleUntil.Sub(before); wait < time.Second {
+		t.Errorf("throttled for %s, want about two seconds, so a retry doesn't bounce straight back", wait)
+	}
+}
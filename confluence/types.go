@@ -61,6 +61,86 @@ type Page struct {
 	ContentType ContentType
 }
 
+// Content is the v1 API's idea of a page or blog post, as returned by CQL search with
+// expand=version,ancestors,space,history:
+// https://developer.atlassian.com/cloud/confluence/rest/v1/api-group-content/#api-wiki-rest-api-content-search-get
+type Content struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"` // page, blogpost, ...
+	Status string `json:"status"`
+	Title  string `json:"title"`
+
+	Space struct {
+		ID  json.Number `json:"id"`
+		Key string      `json:"key"`
+	} `json:"space"`
+
+	History struct {
+		CreatedBy struct {
+			AccountID string `json:"accountId"`
+		} `json:"createdBy"`
+		CreatedDate string `json:"createdDate"`
+	} `json:"history"`
+
+	Version struct {
+		Number    int    `json:"number"`
+		When      string `json:"when"`
+		Message   string `json:"message"`
+		MinorEdit bool   `json:"minorEdit"`
+		By        struct {
+			AccountID string `json:"accountId"`
+		} `json:"by"`
+	} `json:"version"`
+
+	// Outermost first.
+	Ancestors []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"ancestors"`
+
+	Links struct {
+		WebUI  string `json:"webui"`
+		EditUI string `json:"editui"`
+		TinyUI string `json:"tinyui"`
+	} `json:"_links"`
+}
+
+// AsPage translates v1 content into the shape the v2 API would have given us.
+func (c Content) AsPage() Page {
+	page := Page{
+		ID:        c.ID,
+		Status:    c.Status,
+		Title:     c.Title,
+		SpaceID:   c.Space.ID.String(),
+		AuthorID:  c.History.CreatedBy.AccountID,
+		CreatedAt: c.History.CreatedDate,
+		Version: &Version{
+			CreatedAt: c.Version.When,
+			Message:   c.Version.Message,
+			Number:    c.Version.Number,
+			MinorEdit: c.Version.MinorEdit,
+			AuthorID:  c.Version.By.AccountID,
+		},
+		SpaceKey:    c.Space.Key,
+		ContentType: PageContent,
+	}
+
+	if c.Type == "blogpost" {
+		page.ContentType = BlogContent
+	}
+
+	if n := len(c.Ancestors); n > 0 {
+		page.ParentID = c.Ancestors[n-1].ID
+		page.ParentType = c.Ancestors[n-1].Type
+	}
+
+	page.Links.WebUI = c.Links.WebUI
+	page.Links.EditUI = c.Links.EditUI
+	page.Links.TinyUI = c.Links.TinyUI
+
+	return page
+}
+
 // Folder represents a Confluence folder (just organises other pages)
 // Very similar to a page, but non-existent fields have been commented out
 type Folder struct {
@@ -93,6 +173,29 @@ type Folder struct {
 	ContentType ContentType
 }
 
+// See https://developer.atlassian.com/cloud/confluence/rest/v2/api-group-attachment/#api-pages-id-attachments-get
+type Attachment struct {
+	ID         string   `json:"id,omitempty"`
+	Status     string   `json:"status,omitempty"` // current, archived, trashed
+	Title      string   `json:"title,omitempty"`  // this is the file name
+	CreatedAt  string   `json:"createdAt"`
+	PageID     string   `json:"pageId,omitempty"`
+	BlogPostID string   `json:"blogPostId,omitempty"`
+	MediaType  string   `json:"mediaType,omitempty"`
+	Comment    string   `json:"comment,omitempty"`
+	FileID     string   `json:"fileId,omitempty"`
+	FileSize   int64    `json:"fileSize,omitempty"`
+	Version    *Version `json:"version,omitempty"`
+
+	// Relative to the /wiki base URL, e.g. /download/attachments/123/image.png?version=1&api=v2
+	DownloadLink string `json:"downloadLink,omitempty"`
+
+	Links struct {
+		WebUI    string `json:"webui"`
+		Download string `json:"download"`
+	} `json:"_links"`
+}
+
 // Version defines the content version number
 // the version number is used for updating content
 type Version struct {
@@ -105,7 +208,7 @@ type Version struct {
 
 // Body holds the storage information
 type Body struct {
-	Storage        Storage  `json:"storage"`
+	Storage        *Storage `json:"storage,omitempty"`
 	AtlasDocFormat *Storage `json:"atlas_doc_format,omitempty"`
 	View           *Storage `json:"view,omitempty"`
 }
@@ -0,0 +1,82 @@
+package localdump
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/toothbrush/confluence-dump/adf"
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+// ADF's panel types, as the macros we know how to render.
+var adfPanelMacros = map[string]string{
+	"info":    "info",
+	"note":    "note",
+	"tip":     "tip",
+	"success": "tip",
+	"warning": "warning",
+	"error":   "warning",
+}
+
+// convertADF renders a page's atlas_doc_format body, pointing links and media at our copies where
+// we have them.
+func (downloader *SpacesDownloader) convertADF(content *confluence.Page, from RelativePath, mentioned func(accountID string)) (string, error) {
+	if content.Body.AtlasDocFormat == nil {
+		return "", fmt.Errorf("localdump: found nil .Body.AtlasDocFormat field for Object ID %s", content.ID)
+	}
+	doc, err := adf.Parse([]byte(content.Body.AtlasDocFormat.Value))
+	if err != nil {
+		return "", fmt.Errorf("localdump: couldn't read body of %s: %w", content.ID, err)
+	}
+
+	style := downloader.AdmonitionStyle
+	if style == "" {
+		style = AdmonitionGitHub
+	}
+
+	renderer := adf.Renderer{
+		LinkURL: func(href string) string {
+			return downloader.localURL(from, href, true)
+		},
+		MediaURL: func(media adf.Node) string {
+			if media.Attr("type") == "external" {
+				return downloader.localURL(from, media.Attr("url"), false)
+			}
+			if u, ok := downloader.adfMediaURL(ContentID(content.ID), media); ok {
+				return downloader.localURL(from, u, false)
+			}
+			return ""
+		},
+		Mention: func(id string, text string) string {
+			mentioned(id)
+			return downloader.mentionText(id, text)
+		},
+		Panel: func(panelType string, body string) string {
+			macro, ok := adfPanelMacros[panelType]
+			if !ok {
+				macro = "panel"
+			}
+			return strings.TrimSpace(admonition(style, admonitionKinds[style][macro], "", body))
+		},
+	}
+	return renderer.Render(doc), nil
+}
+
+// adfMediaURL finds the attachment a media node shows, by its file ID, and returns where Confluence
+// serves it.  Media nodes say which page they belong to with a collection like "contentId-123".
+func (downloader *SpacesDownloader) adfMediaURL(pageID ContentID, media adf.Node) (string, bool) {
+	ownerID := pageID
+	if owner, ok := strings.CutPrefix(media.Attr("collection"), "contentId-"); ok && owner != "" {
+		ownerID = ContentID(owner)
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+	for _, attachment := range downloader.remoteAttachments[ownerID] {
+		if attachment.FileID == media.Attr("id") {
+			return fmt.Sprintf("/wiki/download/attachments/%s/%s", ownerID, url.PathEscape(attachment.Title)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,142 @@
+package localdump
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// AdmonitionStyle decides which Markdown dialect info/note/warning/tip panels are written in.
+type AdmonitionStyle string
+
+const (
+	// GitHub's alerts: "> [!WARNING]".
+	AdmonitionGitHub AdmonitionStyle = "github"
+	// MkDocs (Material) admonitions: "!!! warning".
+	AdmonitionMkDocs AdmonitionStyle = "mkdocs"
+	// Docusaurus admonitions: ":::warning".
+	AdmonitionDocusaurus AdmonitionStyle = "docusaurus"
+)
+
+func ParseAdmonitionStyle(s string) (AdmonitionStyle, error) {
+	switch AdmonitionStyle(s) {
+	case AdmonitionGitHub, AdmonitionMkDocs, AdmonitionDocusaurus:
+		return AdmonitionStyle(s), nil
+	case "":
+		return AdmonitionGitHub, nil
+	}
+	return "", fmt.Errorf("localdump: unknown admonition style '%s', expected %s, %s or %s",
+		s, AdmonitionGitHub, AdmonitionMkDocs, AdmonitionDocusaurus)
+}
+
+// What each style calls the panel macros.  GitHub has a fixed set of alerts, so Confluence's note
+// (which is for things you'd better not miss) becomes IMPORTANT, and a plain panel a NOTE.
+var admonitionKinds = map[AdmonitionStyle]map[string]string{
+	AdmonitionGitHub: {
+		"info":    "NOTE",
+		"note":    "IMPORTANT",
+		"tip":     "TIP",
+		"warning": "WARNING",
+		"panel":   "NOTE",
+	},
+	AdmonitionMkDocs: {
+		"info":    "info",
+		"note":    "note",
+		"tip":     "tip",
+		"warning": "warning",
+		"panel":   "note",
+	},
+	AdmonitionDocusaurus: {
+		"info":    "info",
+		"note":    "note",
+		"tip":     "tip",
+		"warning": "warning",
+		"panel":   "note",
+	},
+}
+
+// Nested blocks leave runs of blank lines behind, which look silly behind a "> ".
+var blankLinesR = regexp.MustCompile(`\n{3,}`)
+
+// The title of a panel, which we take out of its body before converting.
+const admonitionTitleAttr = "data-confluence-dump-title"
+
+// extractAdmonitionTitles pulls the title and icon out of each panel macro, so they don't end up in
+// the converted body.  The title is kept in an attribute for the admonition rule.
+func extractAdmonitionTitles(selec *goquery.Selection) {
+	selec.Find("div[data-macro-name]").Each(func(_ int, panel *goquery.Selection) {
+		macro, _ := panel.Attr("data-macro-name")
+		if _, ok := admonitionKinds[AdmonitionGitHub][macro]; !ok {
+			return
+		}
+		// info & co. have a <p class="title">, panels a <div class="panelHeader">.
+		header := panel.ChildrenFiltered("p.title, .panelHeader")
+		panel.SetAttr(admonitionTitleAttr, strings.TrimSpace(header.First().Text()))
+		header.Remove()
+		panel.ChildrenFiltered(".confluence-information-macro-icon").Remove()
+	})
+}
+
+// admonitionRule renders the info, note, warning, tip and panel macros as admonitions.
+func admonitionRule(style AdmonitionStyle) md.Rule {
+	if style == "" {
+		style = AdmonitionGitHub
+	}
+	return md.Rule{
+		Filter: []string{"div"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			macro, _ := selec.Attr("data-macro-name")
+			kind, ok := admonitionKinds[style][macro]
+			if !ok {
+				return nil
+			}
+			title, _ := selec.Attr(admonitionTitleAttr)
+			return md.String(admonition(style, kind, title, blankLinesR.ReplaceAllString(strings.TrimSpace(content), "\n\n")))
+		},
+	}
+}
+
+func admonition(style AdmonitionStyle, kind string, title string, body string) string {
+	var b strings.Builder
+	b.WriteString("\n\n")
+
+	switch style {
+	case AdmonitionMkDocs:
+		fmt.Fprintf(&b, "!!! %s", kind)
+		if title != "" {
+			// MkDocs takes the title literally up to the closing quote: there's no escaping it.
+			b.WriteString(` "` + strings.ReplaceAll(title, `"`, "&quot;") + `"`)
+		}
+		b.WriteString("\n")
+		for _, line := range strings.Split(body, "\n") {
+			if line != "" {
+				b.WriteString("    " + line)
+			}
+			b.WriteString("\n")
+		}
+
+	case AdmonitionDocusaurus:
+		fmt.Fprintf(&b, ":::%s", kind)
+		if title != "" {
+			fmt.Fprintf(&b, "[%s]", title)
+		}
+		fmt.Fprintf(&b, "\n\n%s\n\n:::\n", body)
+
+	default:
+		// GitHub alerts don't have titles, so the title goes in bold on the first line.
+		fmt.Fprintf(&b, "> [!%s]\n", kind)
+		if title != "" {
+			fmt.Fprintf(&b, "> **%s**\n>\n", escape.MarkdownCharacters(title))
+		}
+		for _, line := range strings.Split(body, "\n") {
+			b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+		}
+	}
+
+	b.WriteString("\n")
+	return b.String()
+}
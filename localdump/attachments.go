@@ -0,0 +1,374 @@
+package localdump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+// A page's attachments live next to it, in a directory named after the page's file: so
+// 123-title.md keeps its attachments in 123-title.attachments/.
+const attachmentsDirSuffix = ".attachments"
+
+// Images and links to attachments look like
+// /wiki/download/attachments/2946695376/diagram.png?version=1&modificationDate=1700000000000&api=v2
+var attachmentLinkPattern = regexp.MustCompile(`^/wiki/download/(?:attachments|thumbnails)/(\d+)/([^/]+)$`)
+
+func attachmentsDir(pagePath RelativePath) string {
+	return strings.TrimSuffix(string(pagePath), ".md") + attachmentsDirSuffix
+}
+
+func attachmentPath(pagePath RelativePath, attachment confluence.Attachment) RelativePath {
+	return RelativePath(path.Join(attachmentsDir(pagePath), attachmentFilename(attachment)))
+}
+
+// Confluence keeps attachment names unique per page, but they may contain characters we'd rather
+// not have in a filename.
+func attachmentFilename(attachment confluence.Attachment) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, attachment.Title)
+
+	// no hidden files, and certainly no '..'
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = attachment.ID
+	}
+
+	return name
+}
+
+// pageForAttachmentsDir returns the page a directory of attachments belongs to.
+func pageForAttachmentsDir(dir string) RelativePath {
+	return RelativePath(strings.TrimSuffix(dir, attachmentsDirSuffix) + ".md")
+}
+
+func (downloader *SpacesDownloader) generateAttachmentListJobs(ctx context.Context) ([]Job, error) {
+	jobs := []Job{}
+
+	for _, p := range downloader.remotePageMetadata {
+		if p.Page.ContentType == confluence.FolderContent {
+			// folders can't have attachments
+			continue
+		}
+		if downloader.hasFailed(ContentID(p.Page.ID)) {
+			continue
+		}
+		if p.FromLocal {
+			// unchanged since the last sync; seedFromLocal told us what attachments it has.
+			continue
+		}
+
+		id, err := strconv.Atoi(p.Page.ID)
+		if err != nil {
+			return nil, fmt.Errorf("localdump: id was not an int: %w", err)
+		}
+
+		jobs = append(jobs, Job{
+			JobType:     AttachmentsList,
+			PageID:      p.Page.ID,
+			ContentType: p.Page.ContentType,
+			Org:         p.Page.Org,
+			SpaceKey:    p.Page.SpaceKey,
+			GetAttachmentsQuery: confluence.GetAttachmentsQuery{
+				ID:          id,
+				ContentType: p.Page.ContentType,
+				Status:      []string{"current"},
+				Limit:       50,
+			},
+		})
+	}
+
+	return jobs, nil
+}
+
+func (downloader *SpacesDownloader) generateAttachmentFetchJobs(ctx context.Context) ([]Job, error) {
+	jobs := []Job{}
+
+	for pageID, attachments := range downloader.remoteAttachments {
+		page, ok := downloader.remotePageMetadata[pageID]
+		if !ok {
+			return nil, fmt.Errorf("localdump: attachments for unknown page %s", pageID)
+		}
+
+		for _, attachment := range attachments {
+			jobs = append(jobs, Job{
+				JobType:     AttachmentFetch,
+				PageID:      string(pageID),
+				ContentType: page.Page.ContentType,
+				Org:         page.Page.Org,
+				SpaceKey:    page.Page.SpaceKey,
+				Attachment:  attachment,
+			})
+		}
+	}
+
+	return jobs, nil
+}
+
+func (downloader *SpacesDownloader) performAttachmentListJob(ctx context.Context, job Job) (JobResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	apiResult, err := downloader.API.GetAttachments(ctx, job.GetAttachmentsQuery)
+	if confluence.IsNotFound(err) {
+		// the page was deleted since we listed it.  the page download will notice, too.
+		return JobResult{
+			JobType:    job.JobType,
+			space:      job.SpaceKey,
+			finished:   true,
+			itemsFound: 0,
+		}, nil
+	}
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: failed listing attachments: %w", err)
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	if downloader.remoteAttachments == nil {
+		downloader.remoteAttachments = make(map[ContentID][]confluence.Attachment)
+	}
+	pageID := ContentID(job.PageID)
+	downloader.remoteAttachments[pageID] = append(downloader.remoteAttachments[pageID], apiResult.Results...)
+
+	result := JobResult{
+		JobType:    job.JobType,
+		space:      job.SpaceKey,
+		finished:   apiResult.Links.Next == "",
+		itemsFound: len(apiResult.Results),
+	}
+
+	if apiResult.Links.Next == "" {
+		return result, nil
+	}
+
+	q, err := url.Parse(apiResult.Links.Next)
+	if err != nil {
+		return JobResult{}, fmt.Errorf("confluence: couldn't parse _links.next: %w", err)
+	}
+
+	job.GetAttachmentsQuery.Cursor = q.Query().Get("cursor")
+	result.followUpJob = &job
+	if result.followUpJob.GetAttachmentsQuery.Cursor == "" {
+		return JobResult{}, fmt.Errorf("confluence: expected parameter 'cursor' was empty")
+	}
+	return result, nil
+}
+
+func (downloader *SpacesDownloader) performAttachmentDownloadJob(ctx context.Context, job Job) (JobResult, error) {
+	downloader.remoteMetadataMu.Lock()
+	page := downloader.remotePageMetadata[ContentID(job.PageID)].Page
+	pagePath, err := downloader.PagePath(page)
+	downloader.remoteMetadataMu.Unlock()
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: couldn't determine page path: %w", err)
+	}
+
+	target := attachmentPath(pagePath, job.Attachment)
+	result := JobResult{
+		JobType:    job.JobType,
+		space:      job.SpaceKey,
+		finished:   true,
+		itemsFound: 1,
+
+		attachmentPath: target,
+	}
+
+	if downloader.LocalAttachmentIsRecent(ContentID(job.PageID), job.Attachment, target) && !downloader.AlwaysDownload {
+		result.pageDownloadOutcome = SkippedCached
+		return result, nil
+	}
+
+	// attachments can be big, so be patient.
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	contents, err := downloader.API.DownloadAttachment(ctx, job.Attachment)
+	if confluence.IsNotFound(err) {
+		result.pageDownloadOutcome = SkippedMissing
+		return result, nil
+	}
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: failed downloading attachment %s: %w", job.Attachment.ID, err)
+	}
+
+	if err := downloader.WriteAttachmentIntoLocal(target, contents); err != nil {
+		return JobResult{}, fmt.Errorf("localdump: failed writing attachment: %w", err)
+	}
+
+	result.pageDownloadOutcome = SuccessfulDownload
+	return result, nil
+}
+
+// LocalAttachmentIsRecent tells us whether we already have this version of the attachment, in the
+// right place.
+func (downloader *SpacesDownloader) LocalAttachmentIsRecent(pageID ContentID, attachment confluence.Attachment, target RelativePath) bool {
+	if attachment.Version == nil {
+		return false
+	}
+
+	local, ok := downloader.localMarkdownCache[pageID]
+	if !ok {
+		return false
+	}
+
+	for _, ref := range local.Attachments {
+		if ref.ID == attachment.ID && ref.Version == attachment.Version.Number && ref.File == string(target) {
+			_, err := os.Stat(filepath.Join(downloader.StorePath, ref.File))
+			return err == nil
+		}
+	}
+
+	return false
+}
+
+// attachmentsEqual checks whether the attachments listed in a local page's header match what's on
+// Confluence right now.
+func (downloader *SpacesDownloader) attachmentsEqual(pageID ContentID, local []AttachmentRef) bool {
+	remote := downloader.remoteAttachments[pageID]
+	if len(remote) != len(local) {
+		return false
+	}
+
+	versions := make(map[string]int)
+	for _, ref := range local {
+		versions[ref.ID] = ref.Version
+	}
+	for _, attachment := range remote {
+		version, ok := versions[attachment.ID]
+		if !ok || attachment.Version == nil || attachment.Version.Number != version {
+			return false
+		}
+	}
+
+	return true
+}
+
+// attachmentRefs lists a page's attachments, as recorded in its header.
+func (downloader *SpacesDownloader) attachmentRefs(pageID ContentID, pagePath RelativePath) []AttachmentRef {
+	refs := []AttachmentRef{}
+	for _, attachment := range downloader.remoteAttachments[pageID] {
+		ref := AttachmentRef{
+			ID:   attachment.ID,
+			File: string(attachmentPath(pagePath, attachment)),
+		}
+		if attachment.Version != nil {
+			ref.Version = attachment.Version.Number
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// attachmentLink rewrites a link (or image source) pointing at an attachment into a relative link to
+// our local copy, as seen from the file at `from`.
+func (downloader *SpacesDownloader) attachmentLink(from RelativePath, u *url.URL) (string, bool) {
+	if u.Host != downloader.API.BaseURI.Host {
+		return "", false
+	}
+
+	m := attachmentLinkPattern.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", false
+	}
+	ownerID, filename := ContentID(m[1]), m[2]
+
+	downloader.remoteMetadataMu.Lock()
+	var attachment *confluence.Attachment
+	for _, a := range downloader.remoteAttachments[ownerID] {
+		if a.Title == filename {
+			found := a
+			attachment = &found
+			break
+		}
+	}
+	downloader.remoteMetadataMu.Unlock()
+	if attachment == nil {
+		// we're not downloading it, so there's nothing local to point at.
+		return "", false
+	}
+
+	ownerPath, ok := downloader.localPathFor(ownerID)
+	if !ok {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(path.Dir(string(from)), string(attachmentPath(ownerPath, *attachment)))
+	if err != nil {
+		return "", false
+	}
+
+	link := url.URL{Path: filepath.ToSlash(rel)}
+	return link.String(), true
+}
+
+// recordAttachmentFailure notes that we gave up on an attachment, keeping any local copy we had.
+func (downloader *SpacesDownloader) recordAttachmentFailure(job Job, err error) {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	if downloader.failures == nil {
+		downloader.failures = make(map[ContentID]PageFailure)
+	}
+	downloader.failures[ContentID(job.Attachment.ID)] = PageFailure{
+		ID:       ContentID(job.Attachment.ID),
+		Title:    job.Attachment.Title,
+		SpaceKey: job.SpaceKey,
+		Error:    err.Error(),
+		Page:     ContentID(job.PageID),
+	}
+
+	if local, ok := downloader.localMarkdownCache[ContentID(job.PageID)]; ok {
+		for _, ref := range local.Attachments {
+			if ref.ID == job.Attachment.ID {
+				if downloader.freshLocalFiles == nil {
+					downloader.freshLocalFiles = make(map[string]bool)
+				}
+				downloader.freshLocalFiles[ref.File] = true
+			}
+		}
+	}
+}
+
+// ListAllAttachmentFiles returns the absolute pathnames of all attachments kept under inFolder.
+func ListAllAttachmentFiles(inFolder string) ([]string, error) {
+	if _, err := os.Stat(inFolder); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("localdump: error opening %s for file tree walk: %w", inFolder, err)
+	}
+
+	filenames := []string{}
+
+	err := filepath.Walk(inFolder,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("localdump: error during file tree walk: %w", err)
+			}
+			if !info.IsDir() && strings.HasSuffix(filepath.Dir(path), attachmentsDirSuffix) {
+				filenames = append(filenames, path)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("localdump: error initialising file tree walk: %w", err)
+	}
+
+	return filenames, nil
+}
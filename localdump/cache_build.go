@@ -2,53 +2,69 @@ package localdump
 
 import (
 	"fmt"
-	"regexp"
-	"strings"
+	"strconv"
 
 	"github.com/toothbrush/confluence-dump/confluence"
 )
 
-func canonicalise(title string) (string, error) {
-	str := regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(title, " ")
-	str = strings.ToLower(str)
-	str = strings.Join(strings.Fields(str), "-")
-
-	if len(str) > 101 {
-		str = str[:100]
-	}
-
-	str = strings.Trim(str, "-")
-
-	if len(str) < 2 {
-		return "", fmt.Errorf("localdump: slug too short: title was '%s'", title)
-	}
-
-	return str, nil
-}
-
 func (downloader *SpacesDownloader) BuildCacheFromPagelist() error {
 	for id, item := range downloader.remotePageMetadata {
 		ancestors, err := downloader.determineAncestors(item.Page)
 		if err != nil {
-			return fmt.Errorf("localdump: couldn't determine ancestry for %s: %w", item.Page.ID, err)
+			err = fmt.Errorf("localdump: couldn't determine ancestry for %s: %w", item.Page.ID, err)
+			if !downloader.KeepGoing {
+				return err
+			}
+			downloader.recordFailure(id, item.Page.SpaceKey, err)
+			continue
 		}
 
 		if entry, ok := downloader.remotePageMetadata[id]; ok {
-			slug, err := canonicalise(item.Page.Title)
-			if err != nil {
-				return fmt.Errorf("localdump: couldn't derive slug: %w", err)
-			}
 			entry.AncestorIDs = ancestors
-			entry.Slug = slug
+			entry.Slug = downloader.slugFor(item.Page)
 			downloader.remotePageMetadata[id] = entry
 		} else {
 			return fmt.Errorf("localdump: expected key %s missing from remotePageMetadata", id)
 		}
 	}
 
+	downloader.buildTitleIndex()
 	return nil
 }
 
+// titleKey is how storage format names a page, blog post or folder.
+type titleKey struct {
+	spaceKey string
+	title    string
+	kind     confluence.ContentType
+}
+
+// buildTitleIndex indexes what we've listed by space and title, for contentIDByTitle.  Titles are
+// unique per space and type on Confluence's end, but if we somehow see two, a current one wins, then
+// the oldest, so that links don't change from run to run.
+func (downloader *SpacesDownloader) buildTitleIndex() {
+	downloader.titleIndex = make(map[titleKey]ContentID, len(downloader.remotePageMetadata))
+	for id, item := range downloader.remotePageMetadata {
+		key := titleKey{item.Page.SpaceKey, item.Page.Title, item.Page.ContentType}
+		if other, ok := downloader.titleIndex[key]; ok && !titleIndexPrefers(item.Page, downloader.remotePageMetadata[other].Page) {
+			continue
+		}
+		downloader.titleIndex[key] = id
+	}
+}
+
+func titleIndexPrefers(page, other confluence.Page) bool {
+	if (page.Status == "current") != (other.Status == "current") {
+		return page.Status == "current"
+	}
+	id, err1 := strconv.ParseInt(page.ID, 10, 64)
+	otherID, err2 := strconv.ParseInt(other.ID, 10, 64)
+	if err1 != nil || err2 != nil {
+		return page.ID < other.ID
+	}
+	return id < otherID
+}
+
 func (downloader *SpacesDownloader) determineAncestors(page confluence.Page) ([]ContentID, error) {
 	maxDepth := 20
 	ancestors := []ContentID{}
@@ -0,0 +1,46 @@
+package localdump
+
+import (
+	"testing"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+func TestContentIDByTitle(t *testing.T) {
+	listed := []confluence.Page{
+		{ID: "10", Title: "Runbooks", Status: "current", SpaceKey: "SPC", ContentType: confluence.FolderContent},
+		{ID: "20", Title: "Runbooks", Status: "current", SpaceKey: "SPC", ContentType: confluence.PageContent},
+		{ID: "30", Title: "Runbooks", Status: "current", SpaceKey: "SPC", ContentType: confluence.BlogContent},
+		{ID: "40", Title: "Archive", Status: "current", SpaceKey: "SPC", ContentType: confluence.FolderContent},
+		{ID: "900", Title: "Release notes", Status: "current", SpaceKey: "SPC", ContentType: confluence.BlogContent},
+		{ID: "800", Title: "Release notes", Status: "current", SpaceKey: "SPC", ContentType: confluence.BlogContent},
+		{ID: "700", Title: "Release notes", Status: "archived", SpaceKey: "SPC", ContentType: confluence.BlogContent},
+		{ID: "50", Title: "Runbooks", Status: "current", SpaceKey: "OPS", ContentType: confluence.PageContent},
+	}
+	downloader := SpacesDownloader{remotePageMetadata: make(map[ContentID]RemoteObjectMetadata)}
+	for _, page := range listed {
+		downloader.remotePageMetadata[ContentID(page.ID)] = RemoteObjectMetadata{Page: page}
+	}
+	downloader.buildTitleIndex()
+
+	tests := []struct {
+		spaceKey string
+		title    string
+		kind     confluence.ContentType
+		want     ContentID
+	}{
+		{"SPC", "Runbooks", confluence.PageContent, "20"},
+		{"SPC", "Runbooks", confluence.BlogContent, "30"},
+		{"OPS", "Runbooks", confluence.PageContent, "50"},
+		{"SPC", "Archive", confluence.PageContent, "40"},
+		{"SPC", "Archive", confluence.BlogContent, ""},
+		{"SPC", "Release notes", confluence.BlogContent, "800"},
+		{"SPC", "Nowhere", confluence.PageContent, ""},
+	}
+	for _, tt := range tests {
+		got, ok := downloader.contentIDByTitle(tt.spaceKey, tt.title, tt.kind)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("contentIDByTitle(%q, %q, %s) = %q, %t, want %q", tt.spaceKey, tt.title, tt.kind, got, ok, tt.want)
+		}
+	}
+}
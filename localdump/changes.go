@@ -0,0 +1,121 @@
+package localdump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeUpdated ChangeKind = "updated"
+	ChangeMoved   ChangeKind = "moved"
+	ChangeDeleted ChangeKind = "deleted"
+)
+
+// PageChange is something a sync did to a page in the store.
+type PageChange struct {
+	ID       ContentID  `json:"id"`
+	SpaceKey string     `json:"space"`
+	Title    string     `json:"title"`
+	Kind     ChangeKind `json:"kind"`
+
+	OldPath RelativePath `json:"old_path,omitempty"` // unless added
+	NewPath RelativePath `json:"new_path,omitempty"` // unless deleted
+}
+
+// Changes returns what this run did to pages in the store, by space and path.  Folders don't count.
+func (downloader *SpacesDownloader) Changes() []PageChange {
+	downloader.remoteMetadataMu.Lock()
+	changes := slices.Clone(downloader.changes)
+	downloader.remoteMetadataMu.Unlock()
+
+	for _, plan := range downloader.prunePlans {
+		if plan.Refused || downloader.PruneDryRun {
+			continue
+		}
+		for _, c := range plan.Candidates {
+			if c.Reason == PruneDeleted || c.Reason == PruneUnknown {
+				change := PageChange{
+					ID:       c.ID,
+					SpaceKey: plan.Space.Key,
+					Kind:     ChangeDeleted,
+					OldPath:  RelativePath(c.Path),
+				}
+				if local, ok := downloader.localMarkdownCache[c.ID]; ok {
+					change.Title = local.Header.Title
+				}
+				changes = append(changes, change)
+			}
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b PageChange) int {
+		if c := strings.Compare(a.SpaceKey, b.SpaceKey); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.path()), string(b.path()))
+	})
+	return changes
+}
+
+func (change PageChange) path() RelativePath {
+	if change.NewPath != "" {
+		return change.NewPath
+	}
+	return change.OldPath
+}
+
+// recordChange notes what writing md did to the store.  Expects remoteMetadataMu to be held.
+func (downloader *SpacesDownloader) recordChange(md LocalMarkdown, spaceKey string) {
+	if md.Header.ObjectType == confluence.FolderContent.String() {
+		return
+	}
+
+	change := PageChange{
+		ID:       md.ID,
+		SpaceKey: spaceKey,
+		Title:    md.Header.Title,
+		Kind:     ChangeAdded,
+		NewPath:  md.RelativePath,
+	}
+	if old, ok := downloader.localMarkdownCache[md.ID]; ok {
+		change.OldPath = old.RelativePath
+		change.Kind = ChangeUpdated
+		if old.RelativePath != md.RelativePath {
+			change.Kind = ChangeMoved
+		}
+	}
+
+	downloader.changes = append(downloader.changes, change)
+}
+
+// moveLocalCopy moves our copy of a page to where the new version will be written, so that
+// version control sees a rename rather than a deletion and an unrelated new file.
+func (downloader *SpacesDownloader) moveLocalCopy(md LocalMarkdown) error {
+	old, ok := downloader.localMarkdownCache[md.ID]
+	if !ok || old.RelativePath == md.RelativePath || !downloader.WriteMarkdown {
+		return nil
+	}
+
+	from := path.Join(downloader.StorePath, string(old.RelativePath))
+	to := path.Join(downloader.StorePath, string(md.RelativePath))
+	if _, err := os.Stat(to); err == nil {
+		// odd, but we'll just overwrite it.
+		return nil
+	}
+	if err := os.MkdirAll(path.Dir(to), 0750); err != nil {
+		return fmt.Errorf("localdump: couldn't create directory %s: %w", path.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("localdump: couldn't move %s: %w", from, err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package localdump
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+const (
+	checkpointFile    = "checkpoint.json"
+	checkpointVersion = 1
+
+	// how often we save progress while fetching pages, in case we crash.
+	checkpointInterval = 30 * time.Second
+)
+
+// Checkpoint is what an interrupted run leaves behind, so that a --resume run needn't list
+// everything again, or look at pages we already have.
+type Checkpoint struct {
+	Version int `json:"version"`
+
+	// when the interrupted run started, and which spaces it was syncing (by spaceStateKey).
+	Started time.Time `json:"started"`
+	Spaces  []string  `json:"spaces"`
+
+	// spaces (by ID) that were being synced incrementally, since when.
+	IncrementalSince map[string]time.Time `json:"incremental_since"`
+
+	// everything we learnt while listing spaces and fetching folders.  Pages we reconstructed from
+	// our local copy don't need to be in here, we can do that again.
+	Listing map[ContentID]RemoteObjectMetadata `json:"listing"`
+
+	// pages that are done, and files (relative to the store) we mustn't prune.
+	Completed  []ContentID `json:"completed"`
+	FreshFiles []string    `json:"fresh_files"`
+
+	// what we did to the completed pages, for the git commit and the report: once resumed, we
+	// skip those pages, and their local copies are no longer what they were before the run.
+	Changes  []PageChange  `json:"changes"`
+	Outcomes []PageOutcome `json:"outcomes"`
+}
+
+func (downloader *SpacesDownloader) checkpointSpaces() []string {
+	spaces := []string{}
+	for _, space := range downloader.spacesMetadata {
+		spaces = append(spaces, spaceStateKey(space))
+	}
+	slices.Sort(spaces)
+	return spaces
+}
+
+// LoadCheckpoint reads the checkpoint an interrupted run left behind.  If there isn't one, you get
+// nil.
+func LoadCheckpoint(storePath string) (*Checkpoint, error) {
+	filename := path.Join(storePath, stateDirName, checkpointFile)
+	contents, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("localdump: couldn't read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(contents, &checkpoint); err != nil {
+		return nil, fmt.Errorf("localdump: couldn't parse checkpoint %s: %w", filename, err)
+	}
+	if checkpoint.Version != checkpointVersion {
+		return nil, fmt.Errorf("localdump: checkpoint %s has version %d, but we only understand version %d", filename, checkpoint.Version, checkpointVersion)
+	}
+
+	return &checkpoint, nil
+}
+
+// resumeFromCheckpoint picks up where an interrupted run left off, if we've been asked to and
+// there's a checkpoint for the same spaces.  Returns whether we did.
+func (downloader *SpacesDownloader) resumeFromCheckpoint() (bool, error) {
+	checkpoint, err := LoadCheckpoint(downloader.StorePath)
+	if err != nil {
+		return false, err
+	}
+
+	if checkpoint == nil {
+		if downloader.Resume {
+			downloader.Logger.Info("No interrupted run to resume, starting afresh")
+		}
+		return false, nil
+	}
+	if !downloader.Resume {
+		downloader.Logger.Info("Found a checkpoint from an interrupted run; use --resume to continue it",
+			"started", checkpoint.Started.Format(time.DateTime))
+		return false, nil
+	}
+	if !slices.Equal(checkpoint.Spaces, downloader.checkpointSpaces()) {
+		downloader.Logger.Warn("Can't resume: the interrupted run was syncing different spaces, starting afresh",
+			"spaces", checkpoint.Spaces)
+		return false, nil
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	// pretend we started back then, so that the sync cursors stay conservative.
+	downloader.runStarted = checkpoint.Started
+	downloader.incrementalSince = checkpoint.IncrementalSince
+	if downloader.incrementalSince == nil {
+		downloader.incrementalSince = make(map[string]time.Time)
+	}
+
+	downloader.remotePageMetadata = checkpoint.Listing
+	if downloader.remotePageMetadata == nil {
+		downloader.remotePageMetadata = make(map[ContentID]RemoteObjectMetadata)
+	}
+
+	downloader.completedPages = make(map[ContentID]bool)
+	for _, id := range checkpoint.Completed {
+		downloader.completedPages[id] = true
+	}
+	downloader.freshLocalFiles = make(map[string]bool)
+	for _, file := range checkpoint.FreshFiles {
+		downloader.freshLocalFiles[file] = true
+	}
+	downloader.changes = checkpoint.Changes
+	downloader.outcomes = checkpoint.Outcomes
+
+	downloader.Logger.Info("Resuming interrupted run",
+		"started", checkpoint.Started.Format(time.DateTime),
+		"listed", len(downloader.remotePageMetadata),
+		"done", len(downloader.completedPages))
+
+	return true, nil
+}
+
+// saveCheckpoint records our progress so far.
+func (downloader *SpacesDownloader) saveCheckpoint() error {
+	downloader.remoteMetadataMu.Lock()
+	checkpoint := Checkpoint{
+		Version:          checkpointVersion,
+		Started:          downloader.runStarted,
+		Spaces:           downloader.checkpointSpaces(),
+		IncrementalSince: downloader.incrementalSince,
+		Listing:          make(map[ContentID]RemoteObjectMetadata, len(downloader.remotePageMetadata)),
+		Completed:        []ContentID{},
+		FreshFiles:       []string{},
+		Changes:          append([]PageChange{}, downloader.changes...),
+		Outcomes:         append([]PageOutcome{}, downloader.outcomes...),
+	}
+	for id, metadata := range downloader.remotePageMetadata {
+		if !metadata.FromLocal {
+			checkpoint.Listing[id] = metadata
+		}
+	}
+	for id := range downloader.completedPages {
+		checkpoint.Completed = append(checkpoint.Completed, id)
+	}
+	for file := range downloader.freshLocalFiles {
+		checkpoint.FreshFiles = append(checkpoint.FreshFiles, file)
+	}
+	downloader.remoteMetadataMu.Unlock()
+
+	slices.Sort(checkpoint.Completed)
+	slices.Sort(checkpoint.FreshFiles)
+
+	return writeBookkeeping(downloader.StorePath, checkpointFile, checkpoint)
+}
+
+// checkpointPeriodically saves a checkpoint every so often, until you call the returned function.
+func (downloader *SpacesDownloader) checkpointPeriodically() func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := downloader.saveCheckpoint(); err != nil {
+					downloader.Logger.Warn("Couldn't save checkpoint", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// removeCheckpoint is for when a run completes: there's nothing left to resume.
+func (downloader *SpacesDownloader) removeCheckpoint() error {
+	filename := path.Join(downloader.StorePath, stateDirName, checkpointFile)
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("localdump: couldn't remove checkpoint: %w", err)
+	}
+	return nil
+}
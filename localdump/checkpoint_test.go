@@ -0,0 +1,60 @@
+package localdump
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+func TestResumeKeepsChangesAndOutcomes(t *testing.T) {
+	store := t.TempDir()
+	spaces := map[string]confluence.Space{"1": {ID: "1", Key: "SPC", Org: "acme"}}
+
+	interrupted := SpacesDownloader{
+		StorePath:          store,
+		Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		runStarted:         time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		spacesMetadata:     spaces,
+		remotePageMetadata: map[ContentID]RemoteObjectMetadata{},
+		completedPages:     map[ContentID]bool{"100": true, "200": true},
+		changes: []PageChange{
+			{ID: "100", SpaceKey: "SPC", Title: "People Handbook", Kind: ChangeMoved,
+				OldPath: "acme/SPC/100-team-handbook.md", NewPath: "acme/SPC/100-people-handbook.md"},
+			{ID: "200", SpaceKey: "SPC", Title: "Onboarding", Kind: ChangeAdded,
+				NewPath: "acme/SPC/people-handbook/200-onboarding.md"},
+		},
+		outcomes: []PageOutcome{
+			{ID: "100", Space: "SPC", Title: "People Handbook", Action: ActionMoved, OldVersion: 1, NewVersion: 2,
+				OldPath: "acme/SPC/100-team-handbook.md", NewPath: "acme/SPC/100-people-handbook.md"},
+			{ID: "200", Space: "SPC", Title: "Onboarding", Action: ActionCreated, NewVersion: 1,
+				NewPath: "acme/SPC/people-handbook/200-onboarding.md"},
+		},
+	}
+	if err := interrupted.saveCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := SpacesDownloader{
+		StorePath:      store,
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Resume:         true,
+		spacesMetadata: spaces,
+	}
+	if ok, err := resumed.resumeFromCheckpoint(); err != nil || !ok {
+		t.Fatalf("resumeFromCheckpoint() = %t, %v, want to resume", ok, err)
+	}
+
+	if !reflect.DeepEqual(resumed.changes, interrupted.changes) {
+		t.Errorf("resumed changes = %+v, want %+v", resumed.changes, interrupted.changes)
+	}
+	if !reflect.DeepEqual(resumed.outcomes, interrupted.outcomes) {
+		t.Errorf("resumed outcomes = %+v, want %+v", resumed.outcomes, interrupted.outcomes)
+	}
+	if !resumed.completedPages["100"] || !resumed.completedPages["200"] {
+		t.Errorf("resumed completed pages = %v, want 100 and 200", resumed.completedPages)
+	}
+}
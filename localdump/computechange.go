@@ -26,10 +26,14 @@ func (downloader *SpacesDownloader) LocalVersionIsRecent(pageID ContentID) (Loca
 		return LocalMarkdown{}, false, fmt.Errorf("localdump: error comparing ancestry: %w", err)
 	}
 
+	// attachments can come and go without the page's version changing.  if they did, we need to
+	// rewrite the page to point at the right files.
+	attachmentsEqual := !downloader.Attachments || downloader.attachmentsEqual(pageID, ourItem.Attachments)
+
 	// ok, we _are_ aware of it.  how about the version?
 	if remote.Page.Version != nil &&
 		remote.Page.Version.Number == ourItem.Version &&
-		ancestryEqual {
+		ancestryEqual && attachmentsEqual {
 		// oh, we know about it, and it's the same version & ancestry! nothing to do here.
 		return ourItem, true, nil
 	} else {
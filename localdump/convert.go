@@ -3,6 +3,7 @@ package localdump
 import (
 	"fmt"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -15,50 +16,23 @@ import (
 )
 
 func (downloader *SpacesDownloader) ConvertToMarkdown(content *confluence.Page) (LocalMarkdown, error) {
-	// Oh my, this is pretty awful.  md.NewConverter should really accept a BaseURI but actually it
-	// only accepts a hostname.  So we have this hack, adapted from:
-	// https://github.com/JohannesKaufmann/html-to-markdown/issues/44
-	opt := &md.Options{
-		GetAbsoluteURL: func(selec *goquery.Selection, rawURL string, domain string) string {
-			// Function `DefaultGetAbsoluteURL` copied from
-			// https://github.com/JohannesKaufmann/html-to-markdown, for us to be able to mess with
-			// u.Scheme in this block.
-			if domain == "" {
-				return rawURL
-			}
-
-			u, err := url.Parse(rawURL)
-			if err != nil {
-				// we can't do anything with this url because it is invalid
-				return rawURL
-			}
-
-			if u.Scheme == "data" {
-				// this is a data uri (for example an inline base64 image)
-				return rawURL
-			}
-
-			if u.Scheme == "" {
-				u.Scheme = downloader.API.BaseURI.Scheme
-			}
-			if u.Host == "" {
-				u.Host = domain // this comes from the first arg to md.NewConverter
-			}
-
-			return u.String()
-		},
+	// we need to know where this page will live before converting, so we can make relative links.
+	downloader.remoteMetadataMu.Lock()
+	relativeOutputPath, err := downloader.PagePath(*content)
+	downloader.remoteMetadataMu.Unlock()
+	if err != nil {
+		return LocalMarkdown{}, fmt.Errorf("localdump: Couldn't determine page path: %w", err)
 	}
 
-	converter := md.NewConverter(downloader.API.BaseURI.Host, true, opt)
-	// Github flavoured Markdown knows about tables 👍
-	converter.Use(mdplugin.GitHubFlavored())
-	if content.Body.View == nil {
-		return LocalMarkdown{}, fmt.Errorf("localdump: found nil .Body.View field for Object ID %s", content.ID)
+	mentions := []string{}
+	mentioned := func(accountID string) {
+		if !slices.Contains(mentions, accountID) {
+			mentions = append(mentions, accountID)
+		}
 	}
-
-	markdown, err := converter.ConvertString(content.Body.View.Value)
+	markdown, err := downloader.convertBody(content, relativeOutputPath, mentioned)
 	if err != nil {
-		return LocalMarkdown{}, fmt.Errorf("localdump: failed to convert to Markdown: %w", err)
+		return LocalMarkdown{}, err
 	}
 	itemWebURI := downloader.API.BaseURI.String() + content.Links.WebUI
 	if _, err := url.Parse(itemWebURI); err != nil {
@@ -68,10 +42,6 @@ func (downloader *SpacesDownloader) ConvertToMarkdown(content *confluence.Page)
 	downloader.remoteMetadataMu.Lock()
 	defer downloader.remoteMetadataMu.Unlock()
 
-	// Are we able to set a base for all URLs?  Currently the Markdown has things like
-	// '/wiki/spaces/DRE/pages/2946695376/Tools+and+Infrastructure' which are a bit un ergonomic.
-	// we could (fancy mode) resolve to a link in the local dump or (grug mode) just add the
-	// https://redbubble.atlassian.net base URL.
 	ancestorNames := []string{}
 	ancestorIDs := []int{}
 	pageMetadata, ok := downloader.remotePageMetadata[ContentID(content.ID)]
@@ -118,33 +88,143 @@ func (downloader *SpacesDownloader) ConvertToMarkdown(content *confluence.Page)
 		AncestorIDs:   ancestorIDs,
 	}
 
+	if downloader.Attachments {
+		header.Attachments = downloader.attachmentRefs(ContentID(content.ID), relativeOutputPath)
+	}
+
 	if author, ok := downloader.authorMetadata[content.AuthorID]; ok {
 		header.Author = fmt.Sprintf("%s <%s>", author.DisplayName, author.Email)
 	}
-
-	yamlHeader, err := yaml.Marshal(header)
-	if err != nil {
-		return LocalMarkdown{}, fmt.Errorf("localdump: Couldn't marshal header YAML: %w", err)
+	if len(mentions) > 0 {
+		header.Mentions = downloader.mentionHeaders(mentions)
 	}
 
-	// maybe one day consider storing entire header in LocalMarkdown object, and putting the "write
-	// to file" logic elsewhere.
-	body := fmt.Sprintf(`---
-%s
----
-%s
-`,
-		strings.TrimSpace(string(yamlHeader)),
-		markdown)
-
-	relativeOutputPath, err := downloader.PagePath(*content)
+	yamlHeader, err := markdownHeaderYAML(header)
 	if err != nil {
-		return LocalMarkdown{}, fmt.Errorf("localdump: Couldn't determine page path: %w", err)
+		return LocalMarkdown{}, err
 	}
 
 	return LocalMarkdown{
 		ID:           ContentID(content.ID),
-		Content:      body,
+		Content:      markdownFile(yamlHeader, markdown),
 		RelativePath: RelativePath(relativeOutputPath),
+		Header:       header,
+		Mentions:     mentions,
 	}, nil
 }
+
+func markdownHeaderYAML(header MarkdownHeader) (string, error) {
+	yamlHeader, err := yaml.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("localdump: Couldn't marshal header YAML: %w", err)
+	}
+	return strings.TrimSpace(string(yamlHeader)), nil
+}
+
+// markdownFile puts the front matter on top of the page, the way we write it to disk.
+func markdownFile(header string, markdown string) string {
+	return fmt.Sprintf("---\n%s\n---\n%s\n", header, markdown)
+}
+
+// splitMarkdownFile takes apart what markdownFile put together.
+func splitMarkdownFile(content string) (header string, markdown string, ok bool) {
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		return "", "", false
+	}
+	header, markdown, ok = strings.Cut(rest, "\n---\n")
+	return header, strings.TrimSuffix(markdown, "\n"), ok
+}
+
+// bodyHTML is the HTML to convert to Markdown, in whichever format we asked Confluence for.
+func (downloader *SpacesDownloader) bodyHTML(content *confluence.Page) (string, error) {
+	if downloader.bodyFormat() == BodyStorage {
+		return downloader.storageToHTML(content)
+	}
+
+	if content.Body.View == nil {
+		return "", fmt.Errorf("localdump: found nil .Body.View field for Object ID %s", content.ID)
+	}
+	return content.Body.View.Value, nil
+}
+
+// convertBody converts a page's body, in whichever format we asked Confluence for, to Markdown.
+// Tells `mentioned` about each user the page mentions.
+func (downloader *SpacesDownloader) convertBody(content *confluence.Page, relativeOutputPath RelativePath, mentioned func(accountID string)) (string, error) {
+	if content.ContentType == confluence.FolderContent {
+		// folders have no body, whatever the format: our stand-in page only has an empty view.
+		return "", nil
+	}
+	if downloader.bodyFormat() == BodyADF {
+		return downloader.convertADF(content, relativeOutputPath, mentioned)
+	}
+
+	// Oh my, this is pretty awful.  md.NewConverter should really accept a BaseURI but actually it
+	// only accepts a hostname.  So we have this hack, adapted from:
+	// https://github.com/JohannesKaufmann/html-to-markdown/issues/44
+	opt := &md.Options{
+		GetAbsoluteURL: func(selec *goquery.Selection, rawURL string, domain string) string {
+			return downloader.localURL(relativeOutputPath, rawURL, selec.Is("a"))
+		},
+	}
+
+	converter := md.NewConverter(downloader.API.BaseURI.Host, true, opt)
+	// Github flavoured Markdown knows about tables 👍
+	converter.Use(mdplugin.GitHubFlavored())
+	// added last, so they get first dibs on Confluence's macro markup.
+	converter.AddRules(macroRules()...)
+	converter.AddRules(admonitionRule(downloader.AdmonitionStyle))
+	converter.AddRules(downloader.mentionRule(mentioned))
+	converter.Before(extractAdmonitionTitles)
+	bodyHTML, err := downloader.bodyHTML(content)
+	if err != nil {
+		return "", err
+	}
+
+	markdown, err := converter.ConvertString(bodyHTML)
+	if err != nil {
+		return "", fmt.Errorf("localdump: failed to convert to Markdown: %w", err)
+	}
+	return markdown, nil
+}
+
+// localURL makes a URL found in a page absolute, or, if it points at something we have a copy of,
+// relative to the page at `from`.  Only links (not, say, images) go to our copies of other pages.
+func (downloader *SpacesDownloader) localURL(from RelativePath, rawURL string, link bool) string {
+	// Function `DefaultGetAbsoluteURL` copied from
+	// https://github.com/JohannesKaufmann/html-to-markdown, for us to be able to mess with
+	// u.Scheme in this block.
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// we can't do anything with this url because it is invalid
+		return rawURL
+	}
+
+	if u.Scheme == "data" {
+		// this is a data uri (for example an inline base64 image)
+		return rawURL
+	}
+
+	if u.Scheme == "" {
+		u.Scheme = downloader.API.BaseURI.Scheme
+	}
+	if u.Host == "" {
+		u.Host = downloader.API.BaseURI.Host
+	}
+
+	// images and links to attachments we've downloaded should point at our copy.
+	if downloader.Attachments {
+		if link, ok := downloader.attachmentLink(from, u); ok {
+			return link
+		}
+	}
+
+	// Links like '/wiki/spaces/DRE/pages/2946695376/Tools+and+Infrastructure' are a bit
+	// unergonomic.  If we have that page locally, (fancy mode) point to our copy;
+	// otherwise (grug mode) just use the absolute URL.
+	if downloader.RelativeLinks && link {
+		return downloader.relativeLink(from, u)
+	}
+
+	return u.String()
+}
@@ -3,6 +3,7 @@ package localdump
 import (
 	"fmt"
 	"path"
+	"strings"
 
 	"github.com/toothbrush/confluence-dump/confluence"
 )
@@ -16,6 +17,9 @@ func (downloader *SpacesDownloader) PagePath(page confluence.Page) (RelativePath
 
 	for _, ancestorID := range pageMetadata.AncestorIDs {
 		if ancestorMetadata, ok := downloader.remotePageMetadata[ancestorID]; ok {
+			if ancestorMetadata.Slug == "" {
+				return "", fmt.Errorf("localdump: ancestor %s of %s has no usable slug", ancestorID, page.ID)
+			}
 			pathParts = append(pathParts, ancestorMetadata.Slug)
 		} else {
 			// oh no, found an ID with no title mapped!!
@@ -46,13 +50,8 @@ func (downloader *SpacesDownloader) PagePath(page confluence.Page) (RelativePath
 	}
 	pathParts = append([]string{page.Org}, pathParts...)
 
-	slug, err := canonicalise(page.Title)
-	if err != nil {
-		return "", fmt.Errorf("localdump: could not canonicalise title: %w", err)
-	}
-
 	// append my filename, which is <id>-<slug>.md
-	pathParts = append(pathParts, fmt.Sprintf("%s-%s.md", page.ID, slug))
+	pathParts = append(pathParts, fmt.Sprintf("%s-%s.md", page.ID, downloader.slugFor(page)))
 
 	return RelativePath(path.Join(pathParts...)), nil
 }
@@ -60,6 +59,13 @@ func (downloader *SpacesDownloader) PagePath(page confluence.Page) (RelativePath
 func (downloader *SpacesDownloader) userID(page confluence.Page) (string, error) {
 	authorID := page.AuthorID
 	if authorID == "" {
+		// if we only know this blog post from our local copy, that's where its author lives, too:
+		// ORG/blogposts/<author>/<id>-<slug>.md
+		if local, ok := downloader.localMarkdownCache[ContentID(page.ID)]; ok {
+			if parts := strings.Split(string(local.RelativePath), "/"); len(parts) == 4 {
+				return parts[2], nil
+			}
+		}
 		return "", fmt.Errorf("localdump: page .AuthorID blank for item %s", page.ID)
 	}
 
@@ -69,11 +75,10 @@ func (downloader *SpacesDownloader) userID(page confluence.Page) (string, error)
 	}
 
 	if user.DisplayName != "" {
-		slug, err := canonicalise(user.DisplayName)
-		if err != nil {
-			return "", fmt.Errorf("localdump: Failed to canonicalise username '%s': %w", user.DisplayName, err)
+		// if there's nothing usable in their name, we'll try the alternatives below.
+		if slug, err := canonicalise(user.DisplayName, downloader.SlugStyle); err == nil {
+			return slug, nil
 		}
-		return slug, nil
 	}
 	if user.Username != "" {
 		return user.Username, nil
@@ -2,9 +2,12 @@ package localdump
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/url"
+	"os"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -27,14 +30,68 @@ type SpacesDownloader struct {
 	IncludeArchived bool
 	IncludePersonal bool
 
-	Debug bool
+	// How to deal with transient errors; zero fields fall back to DefaultRetryPolicy.
+	Retry RetryPolicy
 
-	Logger   *log.Logger
-	loggerMu sync.Mutex
+	// Don't abort the run when a single page fails; collect the failures and carry on.
+	KeepGoing bool
+
+	// How to turn page titles into file and directory names.
+	SlugStyle SlugStyle
+
+	// Which representation of page bodies to convert from; see BodyFormat.
+	BodyFormat BodyFormat
+
+	// Put mentioned users' email addresses next to their names.
+	MentionEmail bool
+
+	// Which Markdown dialect to write info/note/warning/tip panels in.
+	AdmonitionStyle AdmonitionStyle
+
+	// Rewrite links to other Confluence pages into relative links to our local copies.
+	RelativeLinks bool
+
+	// Download pages' attachments, and point images and links at the local copies.
+	Attachments bool
+
+	// Only ask Confluence for pages changed since the last sync, except every FullSyncInterval, or
+	// if ForceFullSync.
+	Incremental      bool
+	FullSyncInterval time.Duration
+	ForceFullSync    bool
+
+	// Pick up where an interrupted run left off, if it left a checkpoint.
+	Resume bool
+
+	// Move Markdown files we can't parse out of the way, instead of giving up.
+	Quarantine bool
+
+	// Don't prune more than PruneThreshold percent of a space's pages (zero means no limit), unless
+	// ForcePrune.  With PruneDryRun, just work out what we would prune; see PrunePlans().
+	PruneThreshold float64
+	ForcePrune     bool
+	PruneDryRun    bool
+
+	// Commit the store to git after each sync, with a summary of what changed.
+	GitCommit bool
+
+	// How long pruned files stay in the trash; zero means forever.
+	TrashRetention time.Duration
+
+	// Don't draw progress bars, say because we're logging JSON.
+	HideProgress bool
+
+	Logger *slog.Logger
 
 	// spaces metadata
 	spacesMetadata map[string]confluence.Space
 
+	// pages that mention users we didn't know when we wrote them, and who those users are (with
+	// their org), see resolveMentions.  mentionFallbacks is what we called each of those users instead.
+	pendingMentions  map[ContentID]RelativePath
+	unknownMentions  map[string]string
+	mentionFallbacks map[string]map[string]bool
+
 	// local markdown:
 	localMarkdownCache map[ContentID]LocalMarkdown
 
@@ -42,9 +99,54 @@ type SpacesDownloader struct {
 	remotePageMetadata map[ContentID]RemoteObjectMetadata
 	remoteMetadataMu   sync.Mutex
 
+	// remotePageMetadata by space and title, built once we've listed everything.  It doesn't change
+	// while we download, so it's safe to read without the lock.
+	titleIndex map[titleKey]ContentID
+
 	freshLocalFiles map[string]bool
 
+	// files we quarantined, or would have, if this is a dry run: they're not for pruning.
+	quarantinedFiles map[string]bool
+
 	authorMetadata map[string]confluence.User
+
+	// attachments of each page, if we're downloading those
+	remoteAttachments map[ContentID][]confluence.Attachment
+
+	// pages we gave up on, if KeepGoing
+	failures map[ContentID]PageFailure
+
+	// for incremental syncs: when we started, and which spaces (by ID) we're syncing incrementally
+	// since when.
+	runStarted       time.Time
+	incrementalSince map[string]time.Time
+
+	// our manifest of the store, as we found it and as we'll leave it.
+	state State
+
+	// pages we wrote this run, so we can record them in the state.
+	writtenMarkdown map[RelativePath]LocalMarkdown
+
+	// pages we've finished with, in case we get interrupted.
+	completedPages map[ContentID]bool
+
+	// what pruning did, or would do.
+	prunePlans []PrunePlan
+
+	// we're only looking at what's in the store, as for a standalone prune: Prepare doesn't write
+	// folders, and we haven't looked at attachments.  Quarantine still applies.
+	listOnly bool
+
+	// what we did to pages this run.
+	changes []PageChange
+
+	// for the report: what happened to each page, and where the time went.
+	outcomes []PageOutcome
+	phases   []PhaseReport
+
+	// for history exports: every version of every page, and the ones we've fetched so far.
+	remoteVersions  map[ContentID][]confluence.Version
+	fetchedVersions map[pageVersion]LocalMarkdown
 }
 
 type JobType int8
@@ -54,11 +156,17 @@ const (
 	PageFetch
 	UserFetch
 	FolderFetch
+	AttachmentsList
+	AttachmentFetch
+	PagesSearch
+	VersionsList
+	VersionFetch
 )
 
 type Job struct {
-	JobType JobType
-	retries int
+	JobType   JobType
+	retries   int
+	throttled int
 
 	// If fetching PagesList:
 	// This makes us fetch a space by ID or just "blogposts"
@@ -67,6 +175,9 @@ type Job struct {
 	SpaceKey      string
 	// SpaceID       string
 
+	// Or, if PagesSearch, a CQL query for just the pages that changed (Org & SpaceKey apply too):
+	SearchQuery confluence.SearchContentQuery
+
 	// Or, if PageFetch:
 	PageID      string
 	ContentType confluence.ContentType
@@ -77,52 +188,216 @@ type Job struct {
 
 	// Or, if FolderFetch:
 	FolderID int
+
+	// Or, if AttachmentsList (PageID and ContentType are those of the page):
+	GetAttachmentsQuery confluence.GetAttachmentsQuery
+
+	// Or, if AttachmentFetch (PageID and ContentType are those of the page):
+	Attachment confluence.Attachment
+
+	// Or, if VersionsList (PageID and ContentType are those of the page):
+	GetVersionsQuery confluence.GetPageVersionsQuery
+
+	// Or, if VersionFetch, which version of the page to fetch (PageID and ContentType apply too):
+	Version int
 }
 
-func (downloader *SpacesDownloader) DownloadConfluenceSpaces(ctx context.Context, spaces []confluence.Space) error {
+func (downloader *SpacesDownloader) DownloadConfluenceSpaces(ctx context.Context, spaces []confluence.Space) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	if err := downloader.Prepare(ctx, spaces); err != nil {
+		return err
+	}
+
+	// we know everything there is to know about the spaces now, which is worth remembering if we
+	// get interrupted from here on.
+	if downloader.WriteMarkdown {
+		if err := downloader.saveCheckpoint(); err != nil {
+			return fmt.Errorf("localdump: failed to save checkpoint: %w", err)
+		}
+		stopCheckpointing := downloader.checkpointPeriodically()
+		defer func() {
+			stopCheckpointing()
+			if err == nil || errors.Is(err, ErrPagesFailed) || errors.Is(err, ErrPruneRefused) {
+				// we got to the end, there's nothing to resume.
+				if rmErr := downloader.removeCheckpoint(); rmErr != nil {
+					err = errors.Join(err, rmErr)
+				}
+				return
+			}
+			if cpErr := downloader.saveCheckpoint(); cpErr != nil {
+				err = errors.Join(err, cpErr)
+				return
+			}
+			downloader.Logger.Info("Saved a checkpoint; use --resume to continue where we left off")
+		}()
+	}
+
+	// grab list of all users we've ever seen...
+	downloader.Logger.Info("Fetching user metadata")
+	userJobs, err := downloader.generateUserFetchJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't generate user-fetch jobs: %w", err)
+	}
+	if err := downloader.channelSoupRun(ctx, userJobs, len(userJobs), "users"); err != nil {
+		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+	}
+	downloader.Logger.Info("Refreshed users", "refreshed", len(userJobs), "total", len(downloader.authorMetadata))
+
+	attachmentCount := 0
+	if downloader.Attachments {
+		downloader.Logger.Info("Listing attachments")
+		attachmentListJobs, err := downloader.generateAttachmentListJobs(ctx)
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't generate attachment-list jobs: %w", err)
+		}
+		if err := downloader.channelSoupRun(ctx, attachmentListJobs, len(attachmentListJobs), "attachment lists"); err != nil {
+			return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+		}
+
+		downloader.Logger.Info("Fetching attachments")
+		attachmentJobs, err := downloader.generateAttachmentFetchJobs(ctx)
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't generate attachment-fetch jobs: %w", err)
+		}
+		if err := downloader.channelSoupRun(ctx, attachmentJobs, len(attachmentJobs), "attachments"); err != nil {
+			return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+		}
+		attachmentCount = len(attachmentJobs)
+		downloader.Logger.Info("Done fetching attachments", "attachments", attachmentCount)
+	}
+
+	// This is a get-single-page type channelsoup:
+	downloader.Logger.Info("Fetching pages")
+	pageJobs, err := downloader.generateSinglePageDownloadJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't generate single-page jobs: %w", err)
+	}
+	// next, download pages that are stored in downloader.remotePageMetadata:
+	if err := downloader.channelSoupRun(ctx, pageJobs, len(pageJobs), "pages"); err != nil {
+		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+	}
+	downloader.Logger.Info("Done fetching pages")
+
+	if err := downloader.resolveMentions(ctx); err != nil {
+		return err
+	}
+
+	var pruneErr error
+	if downloader.PruneDryRun || (downloader.WriteMarkdown && downloader.Prune) {
+		// finally, prune local Markdown database:
+		donePruning := downloader.startPhase("prune", 0)
+		pruneErr = downloader.pruneLocalDB()
+		donePruning()
+		if pruneErr != nil && !errors.Is(pruneErr, ErrPruneRefused) {
+			return fmt.Errorf("localdump: failed to prune: %w", pruneErr)
+		}
+		// TODO more detail
+		downloader.Logger.Info("Done pruning pages")
+	}
+
+	// don't move the sync cursors if anything failed: the next incremental run would never look at
+	// the failed pages again.
+	failures := downloader.Failures()
+	if downloader.WriteMarkdown {
+		if err := downloader.saveState(len(failures) == 0); err != nil {
+			return fmt.Errorf("localdump: failed to save state: %w", err)
+		}
+	}
+
+	if downloader.WriteMarkdown && downloader.GitCommit {
+		doneCommitting := downloader.startPhase("git", 0)
+		err := downloader.gitCommitSync(ctx)
+		doneCommitting()
+		if err != nil {
+			return fmt.Errorf("localdump: failed to commit to git: %w", err)
+		}
+	}
+
+	if len(failures) > 0 {
+		failedPages, failedAttachments := CountFailures(failures)
+		summary := fmt.Sprintf("%d of %d pages", failedPages, len(pageJobs))
+		if failedAttachments > 0 {
+			summary += fmt.Sprintf(", %d of %d attachments", failedAttachments, attachmentCount)
+		}
+		return errors.Join(fmt.Errorf("%w: %s", ErrPagesFailed, summary), pruneErr)
+	}
+
+	return pruneErr
+}
+
+// Prepare does the groundwork for a download: it loads our state and the local store, lists the
+// spaces (or picks up the listing of an interrupted run), and works out where every page belongs.
+func (downloader *SpacesDownloader) Prepare(ctx context.Context, spaces []confluence.Space) error {
+	downloader.runStarted = time.Now()
 	downloader.spacesMetadata = make(map[string]confluence.Space)
 	for _, s := range spaces {
 		downloader.spacesMetadata[s.ID] = s
 	}
 
+	state, err := LoadState(downloader.StorePath)
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't load state: %w", err)
+	}
+	downloader.state = state
+	downloader.authorMetadata = make(map[string]confluence.User)
+	for id, user := range state.Users {
+		downloader.authorMetadata[id] = user
+	}
+
+	if err := downloader.planIncrementalSpaces(); err != nil {
+		return fmt.Errorf("localdump: couldn't plan incremental sync: %w", err)
+	}
+
 	// first, load up local markdown database:
-	downloader.Logger.Println("Loading local Markdown files, if any...")
+	downloader.Logger.Info("Loading local Markdown files, if any")
+	doneLoading := downloader.startPhase("local", 0)
 	if err := downloader.LoadLocalMarkdown(); err != nil {
 		return fmt.Errorf("localdump: failed to load local Markdown: %w", err)
 	}
-	downloader.Logger.Printf("...loaded %d Markdown files.\n", len(downloader.localMarkdownCache))
+	doneLoading()
+	downloader.Logger.Info("Loaded local Markdown files", "files", len(downloader.localMarkdownCache))
 
-	// less first, determine entire list of pages in the spaces the user wants:
-	downloader.Logger.Printf("Listing pages in %d spaces...\n", len(downloader.spacesMetadata))
-	listPagesInSpacesJobs, err := downloader.generatePageListJobs(ctx)
+	resumed, err := downloader.resumeFromCheckpoint()
 	if err != nil {
-		return fmt.Errorf("localdump: couldn't generate page-list jobs: %w", err)
+		return fmt.Errorf("localdump: couldn't resume: %w", err)
 	}
 
-	if err := downloader.channelSoupRun(ctx, listPagesInSpacesJobs, downloader.Workers*100, "spaces"); err != nil {
-		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+	if !resumed {
+		// less first, determine entire list of pages in the spaces the user wants:
+		downloader.Logger.Info("Listing pages",
+			"spaces", len(downloader.spacesMetadata), "incremental", len(downloader.incrementalSince))
+		listPagesInSpacesJobs, err := downloader.generatePageListJobs(ctx)
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't generate page-list jobs: %w", err)
+		}
+
+		if err := downloader.channelSoupRun(ctx, listPagesInSpacesJobs, downloader.Workers*100, "spaces"); err != nil {
+			return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+		}
+	}
+	if err := downloader.seedFromLocal(); err != nil {
+		return fmt.Errorf("localdump: failed to fill in unchanged pages: %w", err)
 	}
-	downloader.Logger.Printf("...found %d total pages across %d spaces\n",
-		len(downloader.remotePageMetadata),
-		len(downloader.spacesMetadata))
+	downloader.Logger.Info("Listed pages",
+		"pages", len(downloader.remotePageMetadata),
+		"spaces", len(downloader.spacesMetadata))
 
 	// fetch arbitrarily deep folder structures
 	for {
-		downloader.Logger.Println("Scanning for folder‐parent IDs...")
+		downloader.Logger.Info("Scanning for folder‐parent IDs")
 		folderJobs, err := downloader.generateFolderFetchJobs(ctx)
 		if err != nil {
 			return fmt.Errorf("localdump: couldn't generate folder‐fetch jobs: %w", err)
 		}
 
 		if len(folderJobs) == 0 {
-			downloader.Logger.Println("...no more folders to fetch")
+			downloader.Logger.Info("No more folders to fetch")
 			break
 		}
 
-		downloader.Logger.Printf("...fetching %d folder(s)\n", len(folderJobs))
+		downloader.Logger.Info("Fetching folders", "folders", len(folderJobs))
 
 		if err := downloader.channelSoupRun(ctx, folderJobs, len(folderJobs), "folders"); err != nil {
 			return fmt.Errorf("localdump: failed to process folder-fetch jobs: %w", err)
@@ -134,51 +409,27 @@ func (downloader *SpacesDownloader) DownloadConfluenceSpaces(ctx context.Context
 		return fmt.Errorf("localdump: failed to resolve all ancestry: %w", err)
 	}
 
-	// grab list of all users we've ever seen...
-	downloader.Logger.Println("Fetching user metadata...")
-	userJobs, err := downloader.generateUserFetchJobs(ctx)
-	if err != nil {
-		return fmt.Errorf("localdump: couldn't generate user-fetch jobs: %w", err)
-	}
-	if err := downloader.channelSoupRun(ctx, userJobs, len(userJobs), "users"); err != nil {
-		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
-	}
-	downloader.Logger.Printf("...refreshed %d total users.\n",
-		len(downloader.authorMetadata))
-
-	// This is a get-single-page type channelsoup:
-	downloader.Logger.Println("Fetching pages...")
-	pageJobs, err := downloader.generateSinglePageDownloadJobs(ctx)
-	if err != nil {
-		return fmt.Errorf("localdump: couldn't generate single-page jobs: %w", err)
-	}
-	// next, download pages that are stored in downloader.remotePageMetadata:
-	if err := downloader.channelSoupRun(ctx, pageJobs, len(pageJobs), "pages"); err != nil {
-		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
-	}
-	downloader.Logger.Println("...done fetching pages.")
-
-	if downloader.WriteMarkdown && downloader.Prune {
-		// finally, prune local Markdown database:
-		if err := downloader.pruneLocalDB(); err != nil {
-			return fmt.Errorf("localdump: failed to prune: %w", err)
-		}
-		// TODO more detail
-		downloader.Logger.Println("...done pruning pages.")
-	}
-
 	return nil
 }
 
 func (downloader *SpacesDownloader) generateUserFetchJobs(ctx context.Context) ([]Job, error) {
+	// users we remember from last time are good enough, unless we're doing a full refresh anyway.
+	refreshAll := downloader.AlwaysDownload || downloader.ForceFullSync || !downloader.Incremental
 	jobs := make(map[string]Job) // to weed out dupes
 	for _, s := range downloader.remotePageMetadata {
 		id := s.Page.AuthorID
+		if id == "" {
+			// we only know this page from our local copy.
+			continue
+		}
 
 		if _, ok := jobs[id]; ok {
 			// already exists
 			continue
 		}
+		if _, ok := downloader.authorMetadata[id]; ok && !refreshAll {
+			continue
+		}
 
 		jobs[id] = Job{
 			JobType: UserFetch,
@@ -194,6 +445,11 @@ func (downloader *SpacesDownloader) generateUserFetchJobs(ctx context.Context) (
 func (downloader *SpacesDownloader) generatePageListJobs(ctx context.Context) ([]Job, error) {
 	jobs := []Job{}
 	for _, s := range downloader.spacesMetadata {
+		if since, ok := downloader.incrementalSince[s.ID]; ok {
+			jobs = append(jobs, downloader.pageSearchJob(s, since))
+			continue
+		}
+
 		var query confluence.GetPagesQuery
 		query.Status = []string{"current"}
 
@@ -239,6 +495,14 @@ func (downloader *SpacesDownloader) generateSinglePageDownloadJobs(ctx context.C
 			// not a real page
 			continue
 		}
+		if downloader.hasFailed(ContentID(p.Page.ID)) {
+			// already gave up on this one while resolving ancestry.
+			continue
+		}
+		if downloader.completedPages[ContentID(p.Page.ID)] {
+			// done before we got interrupted last time.
+			continue
+		}
 
 		// create initial PageQuery, and pop it in the job queue.
 		// figure out space key this page belongs to:
@@ -301,6 +565,10 @@ func (downloader *SpacesDownloader) performJob(ctx context.Context, job Job) (Jo
 		if err != nil {
 			return JobResult{}, fmt.Errorf("downloader: Confluence download failed: %w", err)
 		}
+		if pageResult.pageDownloadOutcome == SkippedMissing {
+			// nothing local to keep: let pruning take care of any stale copy.
+			return pageResult, nil
+		}
 		// update freshLocalFiles
 		downloader.remoteMetadataMu.Lock()
 		defer downloader.remoteMetadataMu.Unlock()
@@ -308,6 +576,19 @@ func (downloader *SpacesDownloader) performJob(ctx context.Context, job Job) (Jo
 			downloader.freshLocalFiles = make(map[string]bool)
 		}
 		downloader.freshLocalFiles[string(pageResult.page.RelativePath)] = true
+		if pageResult.pageDownloadOutcome == SuccessfulDownload {
+			downloader.recordWritten(*pageResult.page)
+			downloader.recordChange(*pageResult.page, job.SpaceKey)
+		}
+		if pageResult.pageDownloadOutcome == SuccessfulDownload || pageResult.pageDownloadOutcome == SkippedCached {
+			downloader.recordOutcome(*pageResult.page, job.SpaceKey, pageResult.pageDownloadOutcome)
+		}
+		if pageResult.pageDownloadOutcome != FailedDownload {
+			if downloader.completedPages == nil {
+				downloader.completedPages = make(map[ContentID]bool)
+			}
+			downloader.completedPages[ContentID(job.PageID)] = true
+		}
 		return pageResult, nil
 
 	case UserFetch:
@@ -329,14 +610,91 @@ func (downloader *SpacesDownloader) performJob(ctx context.Context, job Job) (Jo
 			downloader.freshLocalFiles = make(map[string]bool)
 		}
 		downloader.freshLocalFiles[string(folderResult.page.RelativePath)] = true
+		if folderResult.pageDownloadOutcome == SuccessfulDownload {
+			downloader.recordWritten(*folderResult.page)
+		}
 		return folderResult, nil
 
+	case PagesSearch:
+		searchResult, err := downloader.performPageSearchJob(ctx, job)
+		if err != nil {
+			return JobResult{}, fmt.Errorf("downloader: Confluence search failed: %w", err)
+		}
+		return searchResult, nil
+
+	case AttachmentsList:
+		listResult, err := downloader.performAttachmentListJob(ctx, job)
+		if err != nil {
+			return JobResult{}, fmt.Errorf("downloader: Confluence download failed: %w", err)
+		}
+		return listResult, nil
+
+	case AttachmentFetch:
+		attachmentResult, err := downloader.performAttachmentDownloadJob(ctx, job)
+		if err != nil {
+			return JobResult{}, fmt.Errorf("downloader: attachment download failed: %w", err)
+		}
+		if attachmentResult.pageDownloadOutcome == SkippedMissing {
+			return attachmentResult, nil
+		}
+		// update freshLocalFiles
+		downloader.remoteMetadataMu.Lock()
+		defer downloader.remoteMetadataMu.Unlock()
+		if downloader.freshLocalFiles == nil {
+			downloader.freshLocalFiles = make(map[string]bool)
+		}
+		downloader.freshLocalFiles[string(attachmentResult.attachmentPath)] = true
+		return attachmentResult, nil
+
+	case VersionsList:
+		listResult, err := downloader.performVersionListJob(ctx, job)
+		if err != nil {
+			return JobResult{}, fmt.Errorf("downloader: Confluence download failed: %w", err)
+		}
+		return listResult, nil
+
+	case VersionFetch:
+		versionResult, err := downloader.performVersionDownloadJob(ctx, job)
+		if err != nil {
+			return JobResult{}, fmt.Errorf("downloader: Confluence download failed: %w", err)
+		}
+		return versionResult, nil
+
 	default:
 		return JobResult{}, fmt.Errorf("downloader: unreachable case jobType = %d", job.JobType)
 	}
 }
 
+// How long jobs that were running when we got interrupted get to finish.  Long enough for the
+// usual page download; anything slower will be done again when we resume.
+const drainTimeout = 5 * time.Second
+
+// draining returns a context for a job that survives ctx being cancelled by drainTimeout, so that
+// Ctrl-C lets jobs in flight finish, but doesn't wait out throttles or huge attachments.
+func draining(ctx context.Context) (context.Context, context.CancelFunc) {
+	jobCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel(context.Cause(ctx))
+		case <-jobCtx.Done():
+		}
+	})
+	return jobCtx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
 func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []Job, chanBufferSize int, phaseName string) error {
+	if len(jobs) == 0 {
+		// nobody would ever close the queue.
+		return nil
+	}
+	defer downloader.startPhase(phaseName, len(jobs))()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -356,6 +714,8 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 
 	results := make(chan JobResult, downloader.Workers*3)
 
+	policy := downloader.retryPolicy()
+
 	grp, gctx := errgroup.WithContext(ctx)
 
 	workers := int32(downloader.Workers)
@@ -372,20 +732,28 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 						}
 						return nil
 					}
-					result, err := downloader.performJob(ctx, job)
-					// at this point we would need to decide what kind of error we have
-					// (instant-stop or transient)
-					//
-					// currently we're insta-stopping on any error.
+					if gctx.Err() != nil {
+						// we've been interrupted, don't start anything new.
+						return context.Cause(gctx)
+					}
+					// if Confluence asked us to back off, don't even start on this job yet.
+					if err := downloader.API.WaitForThrottle(gctx); err != nil {
+						return context.Cause(gctx)
+					}
+					// but a job we've started gets a moment to finish, so we can checkpoint it.
+					jobCtx, stopJob := draining(ctx)
+					result, err := downloader.performJob(jobCtx, job)
+					stopJob()
+					if err != nil && ctx.Err() != nil {
+						// it didn't make it in time; it'll be done again when we resume.
+						return context.Cause(ctx)
+					}
 					if err != nil {
-						if job.retries > 3 {
-							return fmt.Errorf("downloader.performJob: retries exceeded: %w", err)
-						}
-						job.retries++
-						fmt.Printf("hit error %d on %v\n", job.retries, job)
-						result = JobResult{
-							JobType:     job.JobType,
-							followUpJob: &job,
+						// at this point we need to decide what kind of error we have
+						// (instant-stop or transient)
+						result, err = downloader.recoverFromJobError(gctx, job, err, policy)
+						if err != nil {
+							return err
 						}
 					}
 					if result.followUpJob != nil {
@@ -415,7 +783,11 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 			}
 		})
 	}
-	p := mpb.New(mpb.WithWidth(64))
+	progressOutput := io.Writer(os.Stdout)
+	if downloader.HideProgress {
+		progressOutput = nil
+	}
+	p := mpb.New(mpb.WithWidth(64), mpb.WithOutput(progressOutput))
 
 	bar := p.AddBar(int64(unitsOfWorkTotal),
 		mpb.PrependDecorators(
@@ -430,10 +802,12 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 		),
 	)
 
-	// hacky stats - pretend this is just for page download jobs
+	// hacky stats - pretend this is just for page (or attachment) download jobs
 	pagesConsidered := 0
 	pagesCached := 0
 	pagesFetched := 0
+	pagesMissing := 0
+	pagesFailed := 0
 	// print our results
 	grp.Go(func() error {
 		for {
@@ -445,7 +819,7 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 				}
 				// ok means the channel isn't closed yet
 
-				if result.JobType == PageFetch {
+				if result.JobType == PageFetch || result.JobType == AttachmentFetch || result.JobType == VersionFetch {
 					pagesConsidered += 1
 					switch result.pageDownloadOutcome {
 					case SuccessfulDownload:
@@ -453,15 +827,19 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 
 					case SkippedCached:
 						pagesCached += 1
+
+					case SkippedMissing:
+						pagesMissing += 1
+
+					case FailedDownload:
+						pagesFailed += 1
 					}
 				}
 
 				if result.finished {
 					bar.Increment()
 				}
-				if downloader.Debug {
-					downloader.printJobResults(result, unitsOfWorkRemaining, unitsOfWorkTotal)
-				}
+				downloader.logJobResult(ctx, result)
 
 			case <-gctx.Done():
 				return context.Cause(ctx)
@@ -478,29 +856,132 @@ func (downloader *SpacesDownloader) channelSoupRun(ctx context.Context, jobs []J
 	p.Wait()
 
 	if pagesConsidered > 0 {
-		downloader.Logger.Printf("Scanned %d pages, %d cached/skip, %d fetched.\n", pagesConsidered, pagesCached, pagesFetched)
+		downloader.Logger.Info("Scanned "+phaseName,
+			"scanned", pagesConsidered,
+			"cached", pagesCached,
+			"fetched", pagesFetched,
+			"gone", pagesMissing,
+			"failed", pagesFailed)
 	}
 
 	return nil
 }
 
-func (downloader *SpacesDownloader) printJobResults(result JobResult, remaining int32, total int) {
-	downloader.loggerMu.Lock()
+// recoverFromJobError decides what to do about a failed job.  Being throttled is definitely
+// transient, and doesn't count as a retry: we wait out the throttle and try again, up to
+// MaxThrottled times.  Other transient errors get retried with backoff.
+// Anything else insta-stops the run, unless it's a single page and we've been asked to keep going.
+func (downloader *SpacesDownloader) recoverFromJobError(ctx context.Context, job Job, jobErr error, policy RetryPolicy) (JobResult, error) {
+	retry := JobResult{
+		JobType:     job.JobType,
+		followUpJob: &job,
+	}
+
+	throttled := errors.Is(jobErr, confluence.ErrRateLimited)
+	if throttled && job.throttled < policy.MaxThrottled {
+		job.throttled++
+		downloader.Logger.Warn("Rate limited, pausing",
+			"job", job.String(),
+			"throttled", job.throttled,
+			"max_throttled", policy.MaxThrottled,
+			"error", jobErr)
+		// don't requeue until the backoff is over, or the job will just bounce straight back.
+		if err := downloader.API.WaitForThrottle(ctx); err != nil {
+			return JobResult{}, err
+		}
+		return retry, nil
+	}
+
+	retryable := confluence.IsRetryable(jobErr) && !throttled
+	if retryable && job.retries+1 < policy.MaxAttempts {
+		job.retries++
+		delay := policy.backoff(job.retries)
+		downloader.Logger.Warn("Retrying",
+			"job", job.String(),
+			"delay", delay.Round(time.Millisecond),
+			"attempt", job.retries+1,
+			"max_attempts", policy.MaxAttempts,
+			"error", jobErr)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return retry, nil
+		case <-ctx.Done():
+			return JobResult{}, context.Cause(ctx)
+		}
+	}
+
+	var err error
+	if throttled {
+		err = fmt.Errorf("throttled %d times for %s: %w", job.throttled, job, jobErr)
+	} else if retryable {
+		err = fmt.Errorf("retries exceeded for %s: %w", job, jobErr)
+	} else {
+		err = fmt.Errorf("%s failed: %w", job, jobErr)
+	}
+
+	// we're giving up on this job.  that's fatal, unless it's just one page (or attachment) and
+	// we've been asked to keep going.
+	if !downloader.KeepGoing || (job.JobType != PageFetch && job.JobType != AttachmentFetch) {
+		return JobResult{}, fmt.Errorf("downloader.performJob: %w", err)
+	}
+
+	if job.JobType == AttachmentFetch {
+		downloader.recordAttachmentFailure(job, err)
+	} else {
+		downloader.recordFailure(ContentID(job.PageID), job.SpaceKey, err)
+	}
+	downloader.Logger.Warn("Giving up", "job", job.String(), "error", jobErr)
+
+	return JobResult{
+		JobType:    job.JobType,
+		space:      job.SpaceKey,
+		finished:   true,
+		itemsFound: 1,
+
+		pageID:              job.PageID,
+		pageDownloadOutcome: FailedDownload,
+	}, nil
+}
+
+// logJobResult says what a job did, if we're debugging.
+func (downloader *SpacesDownloader) logJobResult(ctx context.Context, result JobResult) {
+	if !downloader.Logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
 	switch result.JobType {
-	case PagesList:
+	case PagesList, PagesSearch:
 		if result.finished {
-			downloader.Logger.Printf("Listed space %s.\n", result.space)
+			downloader.Logger.Debug("Listed space", "space", result.space)
 		}
 	case PageFetch:
 		if result.pageDownloadOutcome == SkippedCached {
-			downloader.Logger.Printf("(v%2d cached): %s\n", result.page.Version, result.page.RelativePath)
+			downloader.Logger.Debug("Cached", "version", result.page.Version, "path", result.page.RelativePath)
+		} else if result.pageDownloadOutcome == SkippedMissing {
+			downloader.Logger.Debug("Gone from Confluence", "id", result.pageID)
+		} else if result.pageDownloadOutcome == FailedDownload {
+			downloader.Logger.Debug("Failed", "id", result.pageID)
 		} else {
-			downloader.Logger.Printf("Fetched: %s\n", result.page.RelativePath)
+			downloader.Logger.Debug("Fetched", "path", result.page.RelativePath)
 		}
 	case UserFetch:
-		downloader.Logger.Printf("Fetched user: %s\n", result.user.Email)
+		downloader.Logger.Debug("Fetched user", "email", result.user.Email)
+	case AttachmentFetch:
+		if result.pageDownloadOutcome == SkippedCached {
+			downloader.Logger.Debug("Cached attachment", "path", result.attachmentPath)
+		} else {
+			downloader.Logger.Debug("Fetched attachment", "path", result.attachmentPath)
+		}
+	case VersionFetch:
+		if result.pageDownloadOutcome == SkippedMissing {
+			downloader.Logger.Debug("Gone from Confluence", "id", result.pageID)
+		} else {
+			downloader.Logger.Debug("Fetched version", "version", result.page.Header.Version, "path", result.page.RelativePath)
+		}
 	}
-	downloader.loggerMu.Unlock()
 }
 
 func (downloader *SpacesDownloader) getPagesOrBlogs(ctx context.Context, job Job) (*confluence.MultiPageResponse, error) {
@@ -525,9 +1006,13 @@ type JobResult struct {
 	// These fields are for page-download jobs:
 	pageDownloadOutcome DownloadAction
 	page                *LocalMarkdown
+	pageID              string
 
 	// Field for user-fetch job:
 	user confluence.User
+
+	// Field for attachment-download job (pageDownloadOutcome applies, too):
+	attachmentPath RelativePath
 }
 
 func (downloader *SpacesDownloader) performPageListJob(ctx context.Context, job Job) (JobResult, error) {
@@ -590,6 +1075,14 @@ func (downloader *SpacesDownloader) performUserDownloadJob(ctx context.Context,
 	defer cancel()
 
 	apiResult, err := downloader.API.GetUserByID(ctx, job.GetUserQuery)
+	if confluence.IsNotFound(err) {
+		// say, someone mentioned a user who's since been deleted.  we'll call them by their ID.
+		return JobResult{
+			JobType:    job.JobType,
+			finished:   true,
+			itemsFound: 1,
+		}, nil
+	}
 	if err != nil {
 		return JobResult{}, fmt.Errorf("localdump: failed getting user: %w", err)
 	}
@@ -600,9 +1093,7 @@ func (downloader *SpacesDownloader) performUserDownloadJob(ctx context.Context,
 	if downloader.authorMetadata == nil {
 		downloader.authorMetadata = make(map[string]confluence.User)
 	}
-	if _, ok := downloader.authorMetadata[job.GetUserQuery.ID]; ok {
-		return JobResult{}, fmt.Errorf("localdump: received duplicate user ID %s from API", job.GetUserQuery.ID)
-	}
+	// we may already know this user from the state, in which case this is a refresh.
 	downloader.authorMetadata[job.GetUserQuery.ID] = *apiResult
 
 	result := JobResult{
@@ -620,6 +1111,8 @@ type DownloadAction int
 const (
 	SuccessfulDownload DownloadAction = iota
 	SkippedCached
+	SkippedMissing // deleted on Confluence since we listed it
+	FailedDownload // gave up, see Failures()
 )
 
 func (downloader *SpacesDownloader) getPageOrBlog(ctx context.Context, job Job) (*confluence.Page, error) {
@@ -631,12 +1124,14 @@ func (downloader *SpacesDownloader) getPageOrBlog(ctx context.Context, job Job)
 	if job.ContentType == confluence.BlogContent {
 		return downloader.API.GetBlogpostByID(ctx, confluence.GetPageByIDQuery{
 			ID:         id,
-			BodyFormat: "view",
+			BodyFormat: string(downloader.bodyFormat()),
+			Version:    job.Version,
 		})
 	} else {
 		return downloader.API.GetPageByID(ctx, confluence.GetPageByIDQuery{
 			ID:         id,
-			BodyFormat: "view",
+			BodyFormat: string(downloader.bodyFormat()),
+			Version:    job.Version,
 		})
 	}
 }
@@ -664,6 +1159,21 @@ func (downloader *SpacesDownloader) performPageDownloadJob(ctx context.Context,
 	defer cancel()
 
 	result, err := downloader.getPageOrBlog(ctx, job)
+	if confluence.IsNotFound(err) {
+		// the page was deleted (or moved somewhere we can't see) since we listed the space.
+		// no sense retrying that.
+		return JobResult{
+			JobType: job.JobType,
+			space:   job.SpaceKey,
+
+			followUpJob: nil,
+			finished:    true,
+			itemsFound:  1,
+
+			pageID:              job.PageID,
+			pageDownloadOutcome: SkippedMissing,
+		}, nil
+	}
 	if err != nil {
 		return JobResult{}, fmt.Errorf("localdump: failed getting page: %w", err)
 	}
@@ -676,9 +1186,16 @@ func (downloader *SpacesDownloader) performPageDownloadJob(ctx context.Context,
 		return JobResult{}, fmt.Errorf("localdump: convert to Markdown failed: %w", err)
 	}
 
+	if downloader.GitCommit {
+		if err := downloader.moveLocalCopy(markdown); err != nil {
+			return JobResult{}, fmt.Errorf("localdump: failed moving file: %w", err)
+		}
+	}
+
 	if err = downloader.WriteMarkdownIntoLocal(markdown); err != nil {
 		return JobResult{}, fmt.Errorf("localdump: failed writing file: %w", err)
 	}
+	downloader.notePendingMentions(result, markdown)
 
 	return JobResult{
 		JobType: job.JobType,
@@ -694,6 +1211,9 @@ func (downloader *SpacesDownloader) performPageDownloadJob(ctx context.Context,
 }
 
 func (downloader *SpacesDownloader) performFolderDownloadJob(ctx context.Context, job Job) (JobResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
 	folder, err := downloader.API.GetFolderByID(ctx, confluence.GetFolderByIDQuery{ID: job.FolderID})
 	if err != nil {
 		return JobResult{}, err
@@ -745,8 +1265,10 @@ func (downloader *SpacesDownloader) performFolderDownloadJob(ctx context.Context
 		return JobResult{}, fmt.Errorf("localdump: convert to Markdown failed: %w", err)
 	}
 
-	if err = downloader.WriteMarkdownIntoLocal(markdown); err != nil {
-		return JobResult{}, fmt.Errorf("localdump: failed writing file: %w", err)
+	if !downloader.listOnly {
+		if err = downloader.WriteMarkdownIntoLocal(markdown); err != nil {
+			return JobResult{}, fmt.Errorf("localdump: failed writing file: %w", err)
+		}
 	}
 
 	return JobResult{
@@ -0,0 +1,96 @@
+package localdump
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrPagesFailed is returned by DownloadConfluenceSpaces when running with KeepGoing and at least
+// one page couldn't be synced.  The details are available from Failures.
+var ErrPagesFailed = errors.New("localdump: some pages failed to sync")
+
+// PageFailure records why we couldn't sync a single page, or one of its attachments.
+type PageFailure struct {
+	ID       ContentID `json:"id"`
+	Title    string    `json:"title"`
+	SpaceKey string    `json:"space"`
+	Error    string    `json:"error"`
+
+	// For an attachment, the page it's attached to; empty if the page itself failed.
+	Page ContentID `json:"page,omitempty"`
+}
+
+// IsAttachment reports whether it was an attachment, rather than a page, that failed.
+func (f PageFailure) IsAttachment() bool {
+	return f.Page != ""
+}
+
+// CountFailures splits failures into failed pages and failed attachments.
+func CountFailures(failures []PageFailure) (pages int, attachments int) {
+	for _, f := range failures {
+		if f.IsAttachment() {
+			attachments++
+		} else {
+			pages++
+		}
+	}
+	return pages, attachments
+}
+
+// Failures lists the pages and attachments that failed during the last run, sorted by space and ID.
+func (downloader *SpacesDownloader) Failures() []PageFailure {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	failures := []PageFailure{}
+	for _, f := range downloader.failures {
+		failures = append(failures, f)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].SpaceKey != failures[j].SpaceKey {
+			return failures[i].SpaceKey < failures[j].SpaceKey
+		}
+		return failures[i].ID < failures[j].ID
+	})
+
+	return failures
+}
+
+// recordFailure notes that we gave up on a page.  If we have a local copy we'll keep it, stale as
+// it may be, rather than let pruning delete it.
+func (downloader *SpacesDownloader) recordFailure(id ContentID, spaceKey string, err error) {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	failure := PageFailure{
+		ID:       id,
+		SpaceKey: spaceKey,
+		Error:    err.Error(),
+	}
+	if remote, ok := downloader.remotePageMetadata[id]; ok {
+		failure.Title = remote.Page.Title
+		if failure.SpaceKey == "" {
+			failure.SpaceKey = remote.Page.SpaceKey
+		}
+	}
+
+	if downloader.failures == nil {
+		downloader.failures = make(map[ContentID]PageFailure)
+	}
+	downloader.failures[id] = failure
+
+	if local, ok := downloader.localMarkdownCache[id]; ok {
+		if downloader.freshLocalFiles == nil {
+			downloader.freshLocalFiles = make(map[string]bool)
+		}
+		downloader.freshLocalFiles[string(local.RelativePath)] = true
+	}
+}
+
+func (downloader *SpacesDownloader) hasFailed(id ContentID) bool {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	_, ok := downloader.failures[id]
+	return ok
+}
@@ -0,0 +1,342 @@
+package localdump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+type FsckProblem string
+
+const (
+	FsckDuplicateID         FsckProblem = "duplicate ID"
+	FsckBrokenHeader        FsckProblem = "broken header"
+	FsckMisplaced           FsckProblem = "misplaced"
+	FsckMissingAncestor     FsckProblem = "missing ancestor"
+	FsckOrphanedAttachments FsckProblem = "orphaned attachments"
+	FsckOrphanedDir         FsckProblem = "orphaned directory"
+	FsckEmptyDir            FsckProblem = "empty directory"
+)
+
+type FsckIssue struct {
+	Problem FsckProblem
+	Path    string // relative to the store
+	ID      ContentID
+	Detail  string
+
+	// if Problem is FsckMisplaced
+	ExpectedPath RelativePath
+
+	Fixed bool
+}
+
+// Fsck checks the store for trouble, without talking to Confluence: files claiming the same ID,
+// files we can't parse, pages that aren't where their ancestry (according to our local copies)
+// says they should be, and directories that don't belong to any page.
+//
+// With fix, we sort out what we can: the duplicate with the lower version goes to the trash, broken
+// files are quarantined, misplaced pages (and their attachments) move to where they belong, orphaned
+// attachments go to the trash and empty directories are removed.
+func (downloader *SpacesDownloader) Fsck(fix bool) ([]FsckIssue, error) {
+	downloader.runStarted = time.Now()
+	issues := []FsckIssue{}
+
+	filenames, err := ListAllMarkdownFiles(downloader.StorePath)
+	if err != nil {
+		return nil, fmt.Errorf("localdump: error listing Markdown files: %w", err)
+	}
+
+	// read everything, warts and all.
+	byID := make(map[ContentID][]LocalMarkdown)
+	for _, file := range filenames {
+		rel, err := filepath.Rel(downloader.StorePath, file)
+		if err != nil {
+			return nil, fmt.Errorf("localdump: couldn't compute relative path of %s: %w", file, err)
+		}
+
+		md, err := ParseExistingMarkdown(downloader.StorePath, rel)
+		if errors.Is(err, ErrBrokenMarkdown) {
+			issue := FsckIssue{Problem: FsckBrokenHeader, Path: rel, Detail: err.Error()}
+			if fix {
+				if err := quarantineFile(downloader.StorePath, rel); err != nil {
+					return issues, err
+				}
+				issue.Fixed = true
+			}
+			issues = append(issues, issue)
+			continue
+		}
+		if err != nil {
+			return issues, err
+		}
+		byID[md.ID] = append(byID[md.ID], md)
+	}
+
+	// of any duplicates, keep the most recent one.
+	downloader.localMarkdownCache = make(map[ContentID]LocalMarkdown)
+	for id, copies := range byID {
+		slices.SortFunc(copies, func(a, b LocalMarkdown) int {
+			if a.Version != b.Version {
+				return b.Version - a.Version
+			}
+			return strings.Compare(string(a.RelativePath), string(b.RelativePath))
+		})
+		keep := copies[0]
+		downloader.localMarkdownCache[id] = keep
+
+		for _, dup := range copies[1:] {
+			issue := FsckIssue{
+				Problem: FsckDuplicateID,
+				Path:    string(dup.RelativePath),
+				ID:      id,
+				Detail:  fmt.Sprintf("v%d; keeping %s (v%d)", dup.Version, keep.RelativePath, keep.Version),
+			}
+			if fix {
+				if err := downloader.trashFile(string(dup.RelativePath)); err != nil {
+					return issues, err
+				}
+				issue.Fixed = true
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	placementIssues, err := downloader.fsckPlacement(fix)
+	issues = append(issues, placementIssues...)
+	if err != nil {
+		return issues, err
+	}
+
+	dirIssues, err := downloader.fsckDirectories(fix)
+	issues = append(issues, dirIssues...)
+	if err != nil {
+		return issues, err
+	}
+
+	slices.SortFunc(issues, func(a, b FsckIssue) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return issues, nil
+}
+
+// fsckPlacement works out where each page should live, based on the ancestry and titles in our
+// local copies, and compares that with where it does live.
+func (downloader *SpacesDownloader) fsckPlacement(fix bool) ([]FsckIssue, error) {
+	issues := []FsckIssue{}
+
+	downloader.remotePageMetadata = make(map[ContentID]RemoteObjectMetadata)
+	if downloader.authorMetadata == nil {
+		downloader.authorMetadata = make(map[string]confluence.User)
+	}
+	for id, local := range downloader.localMarkdownCache {
+		// ORG/SPACE/...
+		parts := strings.Split(string(local.RelativePath), "/")
+		if len(parts) < 3 {
+			continue
+		}
+		page, err := downloader.pageFromLocal(local, confluence.Space{Org: parts[0], Key: parts[1]})
+		if err != nil {
+			issues = append(issues, FsckIssue{Problem: FsckBrokenHeader, Path: string(local.RelativePath), ID: id, Detail: err.Error()})
+			continue
+		}
+		downloader.remotePageMetadata[id] = RemoteObjectMetadata{Page: page, FromLocal: true}
+	}
+
+	resolved := []ContentID{}
+	for id, item := range downloader.remotePageMetadata {
+		ancestors, err := downloader.determineAncestors(item.Page)
+		if err != nil {
+			issues = append(issues, FsckIssue{
+				Problem: FsckMissingAncestor,
+				Path:    string(downloader.localMarkdownCache[id].RelativePath),
+				ID:      id,
+				Detail:  err.Error(),
+			})
+			continue
+		}
+		item.AncestorIDs = ancestors
+		item.Slug = downloader.slugFor(item.Page)
+		downloader.remotePageMetadata[id] = item
+		resolved = append(resolved, id)
+	}
+
+	for _, id := range resolved {
+		local := downloader.localMarkdownCache[id]
+		expected, err := downloader.PagePath(downloader.remotePageMetadata[id].Page)
+		if err != nil {
+			issues = append(issues, FsckIssue{Problem: FsckMissingAncestor, Path: string(local.RelativePath), ID: id, Detail: err.Error()})
+			continue
+		}
+		if expected == local.RelativePath {
+			continue
+		}
+
+		issue := FsckIssue{Problem: FsckMisplaced, Path: string(local.RelativePath), ID: id, ExpectedPath: expected}
+		if fix {
+			if err := downloader.movePage(local.RelativePath, expected); err != nil {
+				issue.Detail = err.Error()
+			} else {
+				issue.Fixed = true
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
+
+// movePage moves a page, and its attachments if it has any, unless that would overwrite something.
+func (downloader *SpacesDownloader) movePage(from, to RelativePath) error {
+	moves := [][2]string{{string(from), string(to)}}
+	if _, err := os.Stat(path.Join(downloader.StorePath, attachmentsDir(from))); err == nil {
+		moves = append(moves, [2]string{attachmentsDir(from), attachmentsDir(to)})
+	}
+
+	for _, move := range moves {
+		if _, err := os.Stat(path.Join(downloader.StorePath, move[1])); err == nil {
+			return fmt.Errorf("localdump: can't move %s, %s already exists", move[0], move[1])
+		}
+	}
+	for _, move := range moves {
+		dest := path.Join(downloader.StorePath, move[1])
+		if err := os.MkdirAll(path.Dir(dest), 0750); err != nil {
+			return fmt.Errorf("localdump: couldn't create directory %s: %w", path.Dir(dest), err)
+		}
+		if err := os.Rename(path.Join(downloader.StorePath, move[0]), dest); err != nil {
+			return fmt.Errorf("localdump: couldn't move %s: %w", move[0], err)
+		}
+	}
+	return nil
+}
+
+// fsckDirectories looks for directories no page accounts for.  A page's children live in a
+// directory named after its slug, next to the page itself: ORG/SPACE/123-title.md has its children
+// in ORG/SPACE/title/.
+func (downloader *SpacesDownloader) fsckDirectories(fix bool) ([]FsckIssue, error) {
+	issues := []FsckIssue{}
+
+	err := filepath.Walk(downloader.StorePath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("localdump: error during file tree walk: %w", err)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == stateDirName {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(downloader.StorePath, file)
+		if err != nil {
+			return fmt.Errorf("localdump: failed to get relative path: %w", err)
+		}
+		parts := strings.Split(rel, "/")
+		if rel == "." || len(parts) < 3 {
+			// the store itself, orgs and spaces.
+			return nil
+		}
+
+		empty, err := isEmptyDir(file)
+		if err != nil {
+			return err
+		}
+		if empty {
+			issue := FsckIssue{Problem: FsckEmptyDir, Path: rel}
+			if fix {
+				if err := os.RemoveAll(file); err != nil {
+					return fmt.Errorf("localdump: couldn't remove %s: %w", file, err)
+				}
+				issue.Fixed = true
+			}
+			issues = append(issues, issue)
+			return filepath.SkipDir
+		}
+
+		if strings.HasSuffix(rel, attachmentsDirSuffix) {
+			page := path.Join(downloader.StorePath, string(pageForAttachmentsDir(rel)))
+			if _, err := os.Stat(page); err == nil {
+				return filepath.SkipDir
+			}
+			issue := FsckIssue{Problem: FsckOrphanedAttachments, Path: rel, Detail: "no such page " + string(pageForAttachmentsDir(rel))}
+			if fix {
+				if err := downloader.trashDir(file); err != nil {
+					return err
+				}
+				issue.Fixed = true
+			}
+			issues = append(issues, issue)
+			return filepath.SkipDir
+		}
+
+		if parts[1] == "blogposts" && len(parts) == 3 {
+			// ORG/blogposts/<author>/
+			return nil
+		}
+
+		owners, err := filepath.Glob(path.Join(path.Dir(file), "*-"+info.Name()+".md"))
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't look for the page owning %s: %w", rel, err)
+		}
+		if len(owners) == 0 {
+			issues = append(issues, FsckIssue{
+				Problem: FsckOrphanedDir,
+				Path:    rel,
+				Detail:  "no page for this directory; a download will move its pages where they belong",
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return issues, fmt.Errorf("localdump: couldn't check directories: %w", err)
+	}
+
+	return issues, nil
+}
+
+// isEmptyDir tells us whether there are no files at all under dir.
+func isEmptyDir(dir string) (bool, error) {
+	empty := true
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("localdump: error during file tree walk: %w", err)
+		}
+		if !info.IsDir() {
+			empty = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return empty, err
+}
+
+// trashDir moves all files under dir to the trash, and removes what's left.
+func (downloader *SpacesDownloader) trashDir(dir string) error {
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("localdump: error during file tree walk: %w", err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(downloader.StorePath, file)
+		if err != nil {
+			return fmt.Errorf("localdump: failed to get relative path: %w", err)
+		}
+		return downloader.trashFile(rel)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("localdump: couldn't remove %s: %w", dir, err)
+	}
+	return nil
+}
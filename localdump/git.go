@@ -0,0 +1,146 @@
+package localdump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// What we don't want in version control: our bookkeeping, the trash, the quarantine.
+const gitignoreContents = "/" + stateDirName + "/\n"
+
+// git runs a git command in the store.
+func (downloader *SpacesDownloader) git(ctx context.Context, stdin string, args ...string) (string, error) {
+	return downloader.gitEnv(ctx, nil, stdin, args...)
+}
+
+// gitEnv runs a git command in the store, with some extra environment variables.
+func (downloader *SpacesDownloader) gitEnv(ctx context.Context, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", downloader.StorePath}, args...)...)
+	cmd.Stdin = strings.NewReader(stdin)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("localdump: git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// ensureGitRepo makes the store a git repository, if it isn't one already.
+func (downloader *SpacesDownloader) ensureGitRepo(ctx context.Context) error {
+	if _, err := downloader.git(ctx, "", "rev-parse", "--is-inside-work-tree"); err == nil {
+		return nil
+	}
+
+	if _, err := downloader.git(ctx, "", "init", "--quiet"); err != nil {
+		return err
+	}
+	gitignore := path.Join(downloader.StorePath, ".gitignore")
+	if _, err := os.Stat(gitignore); errors.Is(err, os.ErrNotExist) {
+		if err := atomicWriteFile(gitignore, []byte(gitignoreContents), 0644); err != nil {
+			return err
+		}
+	}
+	downloader.Logger.Info("Initialised a git repository", "path", downloader.StorePath)
+	return nil
+}
+
+// gitCommitSync stages everything in the spaces we synced, and commits it with a summary of what
+// changed.
+func (downloader *SpacesDownloader) gitCommitSync(ctx context.Context) error {
+	if err := downloader.ensureGitRepo(ctx); err != nil {
+		return err
+	}
+
+	paths := []string{}
+	if _, err := os.Stat(path.Join(downloader.StorePath, ".gitignore")); err == nil {
+		paths = append(paths, ".gitignore")
+	}
+	for _, space := range downloader.spacesMetadata {
+		if _, err := os.Stat(path.Join(downloader.StorePath, space.Org, space.Key)); err == nil {
+			paths = append(paths, path.Join(space.Org, space.Key))
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if _, err := downloader.git(ctx, "", append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return err
+	}
+	if _, err := downloader.git(ctx, "", "diff", "--cached", "--quiet"); err == nil {
+		downloader.Logger.Info("Nothing changed, nothing to commit")
+		return nil
+	}
+
+	message := downloader.commitMessage()
+	if _, err := downloader.git(ctx, message, "commit", "--quiet", "--file=-"); err != nil {
+		return err
+	}
+	downloader.Logger.Info("Committed", "summary", strings.SplitN(message, "\n", 2)[0])
+	return nil
+}
+
+func (downloader *SpacesDownloader) commitMessage() string {
+	changes := downloader.Changes()
+
+	totals := make(map[ChangeKind]int)
+	bySpace := make(map[string][]PageChange)
+	spaces := []string{}
+	for _, change := range changes {
+		totals[change.Kind]++
+		if _, ok := bySpace[change.SpaceKey]; !ok {
+			spaces = append(spaces, change.SpaceKey)
+		}
+		bySpace[change.SpaceKey] = append(bySpace[change.SpaceKey], change)
+	}
+
+	var b strings.Builder
+	if len(changes) == 0 {
+		fmt.Fprintf(&b, "Sync %s\n", downloader.runStarted.Format("2006-01-02 15:04"))
+	} else {
+		fmt.Fprintf(&b, "Sync %s: %s\n", downloader.runStarted.Format("2006-01-02 15:04"), changeCounts(totals))
+	}
+
+	// changes are sorted by space already.
+	for _, key := range spaces {
+		counts := make(map[ChangeKind]int)
+		for _, change := range bySpace[key] {
+			counts[change.Kind]++
+		}
+		fmt.Fprintf(&b, "\n%s: %s\n\n", key, changeCounts(counts))
+
+		for _, change := range bySpace[key] {
+			switch change.Kind {
+			case ChangeMoved:
+				fmt.Fprintf(&b, "  %-8s %s (%s -> %s)\n", change.Kind, change.Title, change.OldPath, change.NewPath)
+			case ChangeDeleted:
+				fmt.Fprintf(&b, "  %-8s %s\n", change.Kind, change.OldPath)
+			default:
+				fmt.Fprintf(&b, "  %-8s %s (%s)\n", change.Kind, change.Title, change.NewPath)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func changeCounts(counts map[ChangeKind]int) string {
+	parts := []string{}
+	for _, kind := range []ChangeKind{ChangeAdded, ChangeUpdated, ChangeMoved, ChangeDeleted} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,167 @@
+package localdump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+func testPage(id, title, parentID string, version int) confluence.Page {
+	return confluence.Page{
+		ID:          id,
+		Title:       title,
+		Status:      "current",
+		ParentID:    parentID,
+		ParentType:  confluence.PageContent.String(),
+		SpaceKey:    "SPC",
+		Org:         "acme",
+		ContentType: confluence.PageContent,
+		Version: &confluence.Version{
+			Number:    version,
+			CreatedAt: time.Date(2024, 1, version, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		},
+		Body: confluence.Body{
+			View: &confluence.Storage{Representation: "view", Value: fmt.Sprintf("<p>%s, version %d</p>", title, version)},
+		},
+	}
+}
+
+// gitSync does what a download with GitCommit does, minus talking to Confluence: it writes the
+// pages that changed since the store was last synced, and commits.
+func gitSync(t *testing.T, storePath string, pages ...confluence.Page) {
+	t.Helper()
+
+	baseURI, _ := url.Parse("https://acme.atlassian.net/wiki")
+	downloader := SpacesDownloader{
+		StorePath:     storePath,
+		API:           &confluence.API{BaseURI: baseURI},
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WriteMarkdown: true,
+		GitCommit:     true,
+		runStarted:    time.Now(),
+		spacesMetadata: map[string]confluence.Space{
+			"1": {ID: "1", Key: "SPC", Org: "acme"},
+		},
+		remotePageMetadata: make(map[ContentID]RemoteObjectMetadata),
+	}
+	for _, page := range pages {
+		downloader.remotePageMetadata[ContentID(page.ID)] = RemoteObjectMetadata{Page: page}
+	}
+	if err := downloader.BuildCacheFromPagelist(); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloader.LoadLocalMarkdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, page := range pages {
+		if _, recent, err := downloader.LocalVersionIsRecent(ContentID(page.ID)); err != nil {
+			t.Fatal(err)
+		} else if recent {
+			continue
+		}
+		md, err := downloader.ConvertToMarkdown(&page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := downloader.moveLocalCopy(md); err != nil {
+			t.Fatal(err)
+		}
+		if err := downloader.WriteMarkdownIntoLocal(md); err != nil {
+			t.Fatal(err)
+		}
+		downloader.recordChange(md, page.SpaceKey)
+	}
+
+	if err := downloader.gitCommitSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitCommitSyncFollowsRenamedAncestor(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	// keep the user's git configuration out of it.
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	store := t.TempDir()
+
+	gitSync(t, store,
+		testPage("100", "Team Handbook", "", 1),
+		testPage("200", "Onboarding", "100", 1))
+
+	if got := runGit(t, store, "log", "--format=%s"); !strings.HasSuffix(got, ": 2 added") {
+		t.Errorf("first commit = %q, want a summary of 2 added pages", got)
+	}
+	if got := runGit(t, store, "ls-files"); got != strings.Join([]string{
+		".gitignore",
+		"acme/SPC/100-team-handbook.md",
+		"acme/SPC/team-handbook/200-onboarding.md",
+	}, "\n") {
+		t.Errorf("committed files:\n%s", got)
+	}
+
+	// renaming the parent moves the child, too.
+	gitSync(t, store,
+		testPage("100", "People Handbook", "", 2),
+		testPage("200", "Onboarding", "100", 1))
+
+	message := runGit(t, store, "log", "-1", "--format=%B")
+	if !strings.Contains(message, ": 2 moved") {
+		t.Errorf("second commit message doesn't summarise 2 moves:\n%s", message)
+	}
+	for _, want := range []string{
+		"moved    People Handbook (acme/SPC/100-team-handbook.md -> acme/SPC/100-people-handbook.md)",
+		"moved    Onboarding (acme/SPC/team-handbook/200-onboarding.md -> acme/SPC/people-handbook/200-onboarding.md)",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("second commit message doesn't contain %q:\n%s", want, message)
+		}
+	}
+
+	// git should see the child as a rename, because it was moved before being rewritten.
+	renames := runGit(t, store, "show", "--format=", "--name-status", "-M", "HEAD")
+	if !strings.Contains(renames, "acme/SPC/team-handbook/200-onboarding.md\tacme/SPC/people-handbook/200-onboarding.md") {
+		t.Errorf("child page wasn't committed as a rename:\n%s", renames)
+	}
+
+	if _, err := os.Stat(path.Join(store, "acme/SPC/team-handbook/200-onboarding.md")); !os.IsNotExist(err) {
+		t.Errorf("child page still at its old path: %v", err)
+	}
+	if _, err := os.Stat(path.Join(store, "acme/SPC/people-handbook/200-onboarding.md")); err != nil {
+		t.Errorf("child page not at its new path: %v", err)
+	}
+
+	// nothing changed, nothing to commit.
+	gitSync(t, store,
+		testPage("100", "People Handbook", "", 2),
+		testPage("200", "Onboarding", "100", 1))
+	if got := runGit(t, store, "rev-list", "--count", "HEAD"); got != "2" {
+		t.Errorf("got %s commits after a sync without changes, want 2", got)
+	}
+}
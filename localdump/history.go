@@ -0,0 +1,411 @@
+package localdump
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+	"golang.org/x/exp/maps"
+)
+
+// How many versions each worker fetches before we stop to commit them.  Keeps memory use in check
+// for spaces with a long history.
+const historyBatchPerWorker = 25
+
+type pageVersion struct {
+	ID      ContentID
+	Version int
+}
+
+// historyEntry is a version of a page we still have to commit.
+type historyEntry struct {
+	key     pageVersion
+	page    confluence.Page // as it is now
+	version confluence.Version
+	created time.Time
+}
+
+// ExportHistory replays every version of every page in the given spaces into the store, oldest
+// first, as one git commit per version, attributed to whoever made the edit.  Pages stay where they
+// live now, whatever they were called back then, so that git can follow them.
+//
+// Versions already in the store are skipped, so running it again picks up where the last run left
+// off, or adds whatever was edited since.
+func (downloader *SpacesDownloader) ExportHistory(ctx context.Context, spaces []confluence.Space) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := downloader.Prepare(ctx, spaces); err != nil {
+		return err
+	}
+
+	// blog posts live under their author's name, so we need those before converting anything.
+	downloader.Logger.Info("Fetching user metadata")
+	userJobs, err := downloader.generateUserFetchJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't generate user-fetch jobs: %w", err)
+	}
+	if err := downloader.channelSoupRun(ctx, userJobs, len(userJobs), "users"); err != nil {
+		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+	}
+
+	downloader.Logger.Info("Listing page versions")
+	versionListJobs, err := downloader.generateVersionListJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't generate version-list jobs: %w", err)
+	}
+	if err := downloader.channelSoupRun(ctx, versionListJobs, len(versionListJobs), "version lists"); err != nil {
+		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+	}
+
+	entries, err := downloader.pendingHistory()
+	if err != nil {
+		return err
+	}
+	downloader.Logger.Info("Listed page versions", "to_export", len(entries))
+
+	// and everyone who ever edited those pages.
+	editorJobs := downloader.generateEditorFetchJobs(entries)
+	if err := downloader.channelSoupRun(ctx, editorJobs, len(editorJobs), "editors"); err != nil {
+		return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+	}
+
+	if err := downloader.ensureGitRepo(ctx); err != nil {
+		return fmt.Errorf("localdump: failed to set up git: %w", err)
+	}
+
+	exportErr := downloader.commitHistory(ctx, entries)
+
+	// whatever we managed to commit is in the store now, so remember that.
+	if err := downloader.saveState(false); err != nil {
+		return errors.Join(exportErr, fmt.Errorf("localdump: failed to save state: %w", err))
+	}
+	return exportErr
+}
+
+func (downloader *SpacesDownloader) commitHistory(ctx context.Context, entries []historyEntry) error {
+	batchSize := max(downloader.Workers, 1) * historyBatchPerWorker
+
+	for start := 0; start < len(entries); start += batchSize {
+		batch := entries[start:min(start+batchSize, len(entries))]
+
+		jobs := make([]Job, 0, len(batch))
+		for _, entry := range batch {
+			jobs = append(jobs, Job{
+				JobType:     VersionFetch,
+				PageID:      entry.page.ID,
+				ContentType: entry.page.ContentType,
+				Org:         entry.page.Org,
+				SpaceKey:    entry.page.SpaceKey,
+				Version:     entry.version.Number,
+			})
+		}
+		downloader.fetchedVersions = make(map[pageVersion]LocalMarkdown)
+		if err := downloader.channelSoupRun(ctx, jobs, len(jobs), "versions"); err != nil {
+			return fmt.Errorf("localdump: failed to channelsoup: %w", err)
+		}
+
+		for _, entry := range batch {
+			if err := downloader.commitVersion(ctx, entry); err != nil {
+				return fmt.Errorf("localdump: failed to commit version %d of %s: %w", entry.key.Version, entry.key.ID, err)
+			}
+		}
+		downloader.Logger.Info("Committed versions", "committed", start+len(batch), "total", len(entries))
+	}
+
+	return nil
+}
+
+func (downloader *SpacesDownloader) commitVersion(ctx context.Context, entry historyEntry) error {
+	md, ok := downloader.fetchedVersions[entry.key]
+	if !ok {
+		// gone from Confluence since we listed it.
+		return nil
+	}
+
+	if err := downloader.moveLocalCopy(md); err != nil {
+		return err
+	}
+	if err := downloader.WriteMarkdownIntoLocal(md); err != nil {
+		return err
+	}
+	downloader.remoteMetadataMu.Lock()
+	downloader.recordWritten(md)
+	downloader.remoteMetadataMu.Unlock()
+
+	paths := []string{path.Join(entry.page.Org, entry.page.SpaceKey)}
+	if _, err := os.Stat(path.Join(downloader.StorePath, ".gitignore")); err == nil {
+		paths = append(paths, ".gitignore")
+	}
+	if _, err := downloader.git(ctx, "", append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return err
+	}
+
+	// an edit may not change anything we render, but it's still part of the history.
+	_, err := downloader.gitEnv(ctx, downloader.versionAuthorEnv(entry), versionCommitMessage(md, entry.version),
+		"commit", "--quiet", "--allow-empty", "--file=-")
+	return err
+}
+
+// versionAuthorEnv makes the commit look like it was made by whoever edited the page, when they
+// did.  Not everyone shares their email address, so we may have to make one up.
+func (downloader *SpacesDownloader) versionAuthorEnv(entry historyEntry) []string {
+	name := entry.version.AuthorID
+	email := ""
+	downloader.remoteMetadataMu.Lock()
+	if user, ok := downloader.authorMetadata[entry.version.AuthorID]; ok {
+		if user.DisplayName != "" {
+			name = user.DisplayName
+		}
+		email = user.Email
+	}
+	downloader.remoteMetadataMu.Unlock()
+
+	if name == "" {
+		name = "Unknown"
+	}
+	if email == "" {
+		local := entry.version.AuthorID
+		if local == "" {
+			local = "unknown"
+		}
+		email = fmt.Sprintf("%s@%s", local, downloader.API.BaseURI.Hostname())
+	}
+	date := entry.created.Format(time.RFC3339)
+
+	return []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + email,
+		"GIT_AUTHOR_DATE=" + date,
+		"GIT_COMMITTER_NAME=" + name,
+		"GIT_COMMITTER_EMAIL=" + email,
+		"GIT_COMMITTER_DATE=" + date,
+	}
+}
+
+func versionCommitMessage(md LocalMarkdown, version confluence.Version) string {
+	subject := strings.TrimSpace(version.Message)
+	if subject == "" && version.Number == 1 {
+		subject = fmt.Sprintf("Create %s", md.Header.Title)
+	} else if subject == "" {
+		subject = fmt.Sprintf("Update %s", md.Header.Title)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", subject)
+	fmt.Fprintf(&b, "Confluence-ID: %s\n", md.ID)
+	fmt.Fprintf(&b, "Confluence-Version: %d\n", version.Number)
+	if version.MinorEdit {
+		fmt.Fprintf(&b, "Minor-Edit: true\n")
+	}
+	return b.String()
+}
+
+// pendingHistory returns the versions we haven't committed yet, oldest first.
+func (downloader *SpacesDownloader) pendingHistory() ([]historyEntry, error) {
+	entries := []historyEntry{}
+
+	for id, versions := range downloader.remoteVersions {
+		page := downloader.remotePageMetadata[id].Page
+
+		// we commit in order, so whatever version we have is the last one we committed.
+		exported := 0
+		if local, ok := downloader.localMarkdownCache[id]; ok {
+			exported = local.Header.Version
+		}
+
+		for _, version := range versions {
+			if version.Number <= exported {
+				continue
+			}
+			created, err := time.Parse(time.RFC3339, version.CreatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("localdump: couldn't parse timestamp %s: %w", version.CreatedAt, err)
+			}
+			entries = append(entries, historyEntry{
+				key:     pageVersion{ID: id, Version: version.Number},
+				page:    page,
+				version: version,
+				created: created,
+			})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b historyEntry) int {
+		if c := a.created.Compare(b.created); c != 0 {
+			return c
+		}
+		if c := strings.Compare(string(a.key.ID), string(b.key.ID)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.key.Version, b.key.Version)
+	})
+	return entries, nil
+}
+
+func (downloader *SpacesDownloader) generateVersionListJobs(ctx context.Context) ([]Job, error) {
+	jobs := []Job{}
+
+	for _, p := range downloader.remotePageMetadata {
+		if p.Page.ContentType == confluence.FolderContent {
+			// folders don't have a history worth speaking of
+			continue
+		}
+
+		id, err := strconv.Atoi(p.Page.ID)
+		if err != nil {
+			return nil, fmt.Errorf("localdump: id was not an int: %w", err)
+		}
+
+		jobs = append(jobs, Job{
+			JobType:     VersionsList,
+			PageID:      p.Page.ID,
+			ContentType: p.Page.ContentType,
+			Org:         p.Page.Org,
+			SpaceKey:    p.Page.SpaceKey,
+			GetVersionsQuery: confluence.GetPageVersionsQuery{
+				ID:          id,
+				ContentType: p.Page.ContentType,
+				Limit:       50,
+			},
+		})
+	}
+
+	return jobs, nil
+}
+
+// generateEditorFetchJobs fetches the users who made the given versions, if we don't know them yet.
+func (downloader *SpacesDownloader) generateEditorFetchJobs(entries []historyEntry) []Job {
+	jobs := make(map[string]Job) // to weed out dupes
+	for _, entry := range entries {
+		id := entry.version.AuthorID
+		if id == "" {
+			continue
+		}
+		if _, ok := jobs[id]; ok {
+			continue
+		}
+		if _, ok := downloader.authorMetadata[id]; ok {
+			continue
+		}
+
+		jobs[id] = Job{
+			JobType: UserFetch,
+			Org:     entry.page.Org,
+			GetUserQuery: confluence.GetUserByIDQuery{
+				ID: id,
+			},
+		}
+	}
+	return maps.Values(jobs)
+}
+
+func (downloader *SpacesDownloader) performVersionListJob(ctx context.Context, job Job) (JobResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	apiResult, err := downloader.API.GetPageVersions(ctx, job.GetVersionsQuery)
+	if confluence.IsNotFound(err) {
+		// the page was deleted since we listed it.
+		return JobResult{
+			JobType:    job.JobType,
+			space:      job.SpaceKey,
+			finished:   true,
+			itemsFound: 0,
+		}, nil
+	}
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: failed listing versions: %w", err)
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	if downloader.remoteVersions == nil {
+		downloader.remoteVersions = make(map[ContentID][]confluence.Version)
+	}
+	pageID := ContentID(job.PageID)
+	downloader.remoteVersions[pageID] = append(downloader.remoteVersions[pageID], apiResult.Results...)
+
+	result := JobResult{
+		JobType:    job.JobType,
+		space:      job.SpaceKey,
+		finished:   apiResult.Links.Next == "",
+		itemsFound: len(apiResult.Results),
+	}
+
+	if apiResult.Links.Next == "" {
+		return result, nil
+	}
+
+	q, err := url.Parse(apiResult.Links.Next)
+	if err != nil {
+		return JobResult{}, fmt.Errorf("confluence: couldn't parse _links.next: %w", err)
+	}
+
+	job.GetVersionsQuery.Cursor = q.Query().Get("cursor")
+	result.followUpJob = &job
+	if result.followUpJob.GetVersionsQuery.Cursor == "" {
+		return JobResult{}, fmt.Errorf("confluence: expected parameter 'cursor' was empty")
+	}
+	return result, nil
+}
+
+func (downloader *SpacesDownloader) performVersionDownloadJob(ctx context.Context, job Job) (JobResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	result, err := downloader.getPageOrBlog(ctx, job)
+	if confluence.IsNotFound(err) {
+		return JobResult{
+			JobType:    job.JobType,
+			space:      job.SpaceKey,
+			finished:   true,
+			itemsFound: 1,
+
+			pageID:              job.PageID,
+			pageDownloadOutcome: SkippedMissing,
+		}, nil
+	}
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: failed getting page version: %w", err)
+	}
+	result.ContentType = job.ContentType
+	result.SpaceKey = job.SpaceKey
+	result.Org = job.Org
+
+	markdown, err := downloader.ConvertToMarkdown(result)
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: convert to Markdown failed: %w", err)
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	// the title may have changed since, but we want the page to stay put.  it's the same directory
+	// either way, so relative links still work.
+	markdown.RelativePath, err = downloader.PagePath(downloader.remotePageMetadata[ContentID(job.PageID)].Page)
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: couldn't determine page path: %w", err)
+	}
+	downloader.fetchedVersions[pageVersion{ID: ContentID(job.PageID), Version: job.Version}] = markdown
+
+	return JobResult{
+		JobType:    job.JobType,
+		space:      job.SpaceKey,
+		finished:   true,
+		itemsFound: 1,
+
+		page:                &markdown,
+		pageDownloadOutcome: SuccessfulDownload,
+	}, nil
+}
@@ -0,0 +1,239 @@
+package localdump
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+// CQL only knows about minutes, in the user's profile timezone, which we don't know.  So we ask for
+// a generous overlap with the previous sync: the extra pages we list will just be skipped as cached.
+const incrementalOverlap = 24 * time.Hour
+
+// DefaultFullSyncInterval is how often an incremental sync falls back to listing everything, which
+// is the only way to notice deleted pages.
+const DefaultFullSyncInterval = 7 * 24 * time.Hour
+
+// planIncrementalSpaces decides which spaces we can get away with syncing incrementally.
+func (downloader *SpacesDownloader) planIncrementalSpaces() error {
+	downloader.incrementalSince = make(map[string]time.Time)
+
+	if !downloader.Incremental {
+		return nil
+	}
+
+	if downloader.ForceFullSync || downloader.AlwaysDownload {
+		return nil
+	}
+
+	interval := downloader.FullSyncInterval
+	if interval <= 0 {
+		interval = DefaultFullSyncInterval
+	}
+
+	for id, space := range downloader.spacesMetadata {
+		spaceState, ok := downloader.state.Spaces[spaceStateKey(space)]
+		if !ok || spaceState.LastSync.IsZero() {
+			// never synced this one, we need to see everything.
+			continue
+		}
+		if downloader.runStarted.Sub(spaceState.LastFullSync) > interval {
+			// time for a periodic full listing.
+			continue
+		}
+		downloader.incrementalSince[id] = spaceState.LastSync
+	}
+
+	return nil
+}
+
+func (downloader *SpacesDownloader) pageSearchJob(space confluence.Space, since time.Time) Job {
+	cutoff := since.Add(-incrementalOverlap).UTC().Format("2006-01-02 15:04")
+
+	// ask for the same content a full listing would find: see generatePageListJobs.
+	clauses := []string{}
+	contentType := confluence.PageContent
+	if space.Key == "blogposts" {
+		// our phantom "space" contains everybody's blog posts, wherever they are.
+		contentType = confluence.BlogContent
+	} else {
+		clauses = append(clauses, fmt.Sprintf(`space = "%s"`, space.Key))
+	}
+	clauses = append(clauses, fmt.Sprintf(`type = %s`, contentType))
+	if downloader.IncludeArchived {
+		clauses = append(clauses, `status in ("current", "archived")`)
+	} else {
+		clauses = append(clauses, `status = "current"`)
+	}
+	clauses = append(clauses, fmt.Sprintf(`lastmodified >= "%s"`, cutoff))
+	cql := strings.Join(clauses, " and ")
+
+	return Job{
+		JobType:     PagesSearch,
+		Org:         space.Org,
+		SpaceKey:    space.Key,
+		ContentType: contentType,
+		SearchQuery: confluence.SearchContentQuery{
+			CQL:    cql,
+			Expand: []string{"version", "ancestors", "space", "history"},
+			Limit:  50,
+		},
+	}
+}
+
+func (downloader *SpacesDownloader) performPageSearchJob(ctx context.Context, job Job) (JobResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	apiResult, err := downloader.API.SearchContent(ctx, job.SearchQuery)
+	if err != nil {
+		return JobResult{}, fmt.Errorf("localdump: failed searching for changed pages: %w", err)
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	if downloader.remotePageMetadata == nil {
+		downloader.remotePageMetadata = make(map[ContentID]RemoteObjectMetadata)
+	}
+	for _, content := range apiResult.Results {
+		p := content.AsPage()
+		if _, ok := downloader.remotePageMetadata[ContentID(p.ID)]; ok {
+			return JobResult{}, fmt.Errorf("localdump: received duplicate ID %s from API", p.ID)
+		}
+		p.SpaceKey = job.SpaceKey
+		p.Org = job.Org
+		if p.ContentType == confluence.BlogContent {
+			p.SpaceID = "blogposts"
+		}
+
+		downloader.remotePageMetadata[ContentID(p.ID)] = RemoteObjectMetadata{
+			Page: p,
+		}
+	}
+
+	result := JobResult{
+		JobType:    job.JobType,
+		space:      job.SpaceKey,
+		finished:   apiResult.Links.Next == "",
+		itemsFound: len(apiResult.Results),
+	}
+
+	if apiResult.Links.Next == "" {
+		return result, nil
+	}
+
+	q, err := url.Parse(apiResult.Links.Next)
+	if err != nil {
+		return JobResult{}, fmt.Errorf("confluence: couldn't parse _links.next: %w", err)
+	}
+
+	job.SearchQuery.Cursor = q.Query().Get("cursor")
+	result.followUpJob = &job
+	if result.followUpJob.SearchQuery.Cursor == "" {
+		return JobResult{}, fmt.Errorf("confluence: expected parameter 'cursor' was empty")
+	}
+	return result, nil
+}
+
+// seedFromLocal fills in the remote metadata for spaces we synced incrementally.  Anything that
+// didn't show up in the search hasn't changed, so our local copy tells us all we need to know about
+// it, e.g. for working out ancestry.
+func (downloader *SpacesDownloader) seedFromLocal() error {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	for spaceID := range downloader.incrementalSince {
+		space := downloader.spacesMetadata[spaceID]
+		prefix := path.Join(space.Org, space.Key) + "/"
+
+		for id, local := range downloader.localMarkdownCache {
+			if !strings.HasPrefix(string(local.RelativePath), prefix) {
+				continue
+			}
+			if _, ok := downloader.remotePageMetadata[id]; ok {
+				// changed recently, we've got fresh info.
+				continue
+			}
+
+			page, err := downloader.pageFromLocal(local, space)
+			if err != nil {
+				return fmt.Errorf("localdump: couldn't reconstruct metadata for %s: %w", local.RelativePath, err)
+			}
+			downloader.remotePageMetadata[id] = RemoteObjectMetadata{
+				Page:      page,
+				FromLocal: true,
+			}
+
+			// we won't ask about attachments of unchanged pages either, so assume we still have
+			// the right ones.
+			if downloader.Attachments && len(local.Attachments) > 0 {
+				if downloader.remoteAttachments == nil {
+					downloader.remoteAttachments = make(map[ContentID][]confluence.Attachment)
+				}
+				for _, ref := range local.Attachments {
+					downloader.remoteAttachments[id] = append(downloader.remoteAttachments[id], confluence.Attachment{
+						ID:      ref.ID,
+						Title:   path.Base(ref.File),
+						Version: &confluence.Version{Number: ref.Version},
+					})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (downloader *SpacesDownloader) pageFromLocal(local LocalMarkdown, space confluence.Space) (confluence.Page, error) {
+	header := local.Header
+
+	page := confluence.Page{
+		ID:      string(local.ID),
+		Status:  header.Status,
+		Title:   header.Title,
+		SpaceID: space.ID,
+		Version: &confluence.Version{
+			CreatedAt: header.Timestamp.Format(time.RFC3339),
+			Number:    header.Version,
+		},
+		SpaceKey: space.Key,
+		Org:      space.Org,
+	}
+	if downloader.API != nil {
+		page.Links.WebUI = strings.TrimPrefix(header.URI, downloader.API.BaseURI.String())
+	}
+
+	switch header.ObjectType {
+	case confluence.BlogContent.String():
+		page.ContentType = confluence.BlogContent
+	case confluence.FolderContent.String():
+		page.ContentType = confluence.FolderContent
+		page.SpaceID = "folders"
+	case confluence.PageContent.String():
+		page.ContentType = confluence.PageContent
+	default:
+		return confluence.Page{}, fmt.Errorf("localdump: unknown object type '%s'", header.ObjectType)
+	}
+
+	if n := len(local.AncestorIDs); n > 0 {
+		parentID := local.AncestorIDs[n-1]
+		page.ParentID = string(parentID)
+		page.ParentType = confluence.PageContent.String()
+		if parent, ok := downloader.localMarkdownCache[parentID]; ok {
+			page.ParentType = parent.Header.ObjectType
+		}
+	}
+
+	if _, err := strconv.Atoi(page.ID); err != nil {
+		return confluence.Page{}, fmt.Errorf("localdump: object ID %s not an int: %w", page.ID, err)
+	}
+
+	return page, nil
+}
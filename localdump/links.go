@@ -0,0 +1,87 @@
+package localdump
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// Confluence page links come in a few shapes, e.g.:
+//
+//	/wiki/spaces/DRE/pages/2946695376/Tools+and+Infrastructure
+//	/wiki/spaces/DRE/blog/2023/06/01/2946695376/Some+Post
+//	/wiki/spaces/DRE/folder/2946695376
+//	/wiki/pages/viewpage.action?pageId=2946695376
+var (
+	pageLinkPattern     = regexp.MustCompile(`^/wiki/spaces/[^/]+/(?:pages|folder)/(\d+)(?:/|$)`)
+	blogpostLinkPattern = regexp.MustCompile(`^/wiki/spaces/[^/]+/blog/\d{4}/\d{2}/\d{2}/(\d+)(?:/|$)`)
+	viewPageLinkPattern = regexp.MustCompile(`^/wiki/pages/viewpage\.action$`)
+)
+
+// linkedContentID returns the ID of the Confluence object an (absolute) URL points to, if it points
+// to one on our instance.
+func (downloader *SpacesDownloader) linkedContentID(u *url.URL) (ContentID, bool) {
+	if u.Host != downloader.API.BaseURI.Host {
+		return "", false
+	}
+
+	for _, pattern := range []*regexp.Regexp{pageLinkPattern, blogpostLinkPattern} {
+		if m := pattern.FindStringSubmatch(u.Path); m != nil {
+			return ContentID(m[1]), true
+		}
+	}
+
+	if viewPageLinkPattern.MatchString(u.Path) {
+		if id := u.Query().Get("pageId"); id != "" {
+			return ContentID(id), true
+		}
+	}
+
+	return "", false
+}
+
+// localPathFor finds where the given object lives (or will live, after this run) in the local
+// dump.
+func (downloader *SpacesDownloader) localPathFor(id ContentID) (RelativePath, bool) {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	if remote, ok := downloader.remotePageMetadata[id]; ok && remote.Slug != "" {
+		if p, err := downloader.PagePath(remote.Page); err == nil {
+			return p, true
+		}
+	}
+
+	// maybe it's in a space we're not syncing right now, but have synced before.
+	if local, ok := downloader.localMarkdownCache[id]; ok {
+		return local.RelativePath, true
+	}
+
+	return "", false
+}
+
+// relativeLink rewrites a link to a Confluence object into a relative link to our local copy of it,
+// as seen from the file at `from`.  If we don't have a local copy, you get the URL back as-is.
+func (downloader *SpacesDownloader) relativeLink(from RelativePath, u *url.URL) string {
+	id, ok := downloader.linkedContentID(u)
+	if !ok {
+		return u.String()
+	}
+
+	target, ok := downloader.localPathFor(id)
+	if !ok {
+		return u.String()
+	}
+
+	rel, err := filepath.Rel(path.Dir(string(from)), string(target))
+	if err != nil {
+		return u.String()
+	}
+
+	link := url.URL{
+		Path:     filepath.ToSlash(rel),
+		Fragment: u.Fragment,
+	}
+	return link.String()
+}
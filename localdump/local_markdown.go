@@ -13,6 +13,15 @@ type LocalMarkdown struct {
 
 	AncestorIDs []ContentID
 
+	// attachments we've downloaded for this page, if any
+	Attachments []AttachmentRef
+
+	// the front matter, as we wrote it
+	Header MarkdownHeader
+
+	// account IDs of the users the page @mentions, if we converted it this run
+	Mentions []string
+
 	// path relative to DUMP location (e.g., ~/confluence)
 	RelativePath RelativePath
 }
@@ -21,6 +30,10 @@ type RemoteObjectMetadata struct {
 	Slug        string
 	AncestorIDs []ContentID
 
+	// Set if Confluence didn't tell us about this object during an incremental sync, so we
+	// reconstructed it from our local copy.
+	FromLocal bool
+
 	Page confluence.Page
 }
 
@@ -0,0 +1,106 @@
+package localdump
+
+import (
+	"fmt"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/toothbrush/confluence-dump/adf"
+)
+
+// Confluence's code macro names its languages after the old SyntaxHighlighter brushes; these are the
+// ones that don't match what Markdown highlighters expect.
+var codeBrushLanguages = map[string]string{
+	"actionscript3": "actionscript",
+	"as3":           "actionscript",
+	"c#":            "csharp",
+	"c-sharp":       "csharp",
+	"cf":            "cfm",
+	"coldfusion":    "cfm",
+	"erl":           "erlang",
+	"jfx":           "javafx",
+	"js":            "javascript",
+	"jscript":       "javascript",
+	"pas":           "pascal",
+	"delphi":        "pascal",
+	"pl":            "perl",
+	"ps":            "powershell",
+	"py":            "python",
+	"rb":            "ruby",
+	"sh":            "bash",
+	"shell":         "bash",
+	"vbnet":         "vb",
+	"yml":           "yaml",
+
+	// no highlighting, please.
+	"text":  "",
+	"plain": "",
+	"none":  "",
+}
+
+// macroRules turns Confluence's rendered macros back into something Markdown-shaped, rather than
+// letting the generic rules flatten them.
+func macroRules() []md.Rule {
+	return []md.Rule{
+		{
+			// <div class="code panel" data-macro-name="code">, with an optional header holding the title
+			// and the code itself in a <pre class="syntaxhighlighter-pre">.
+			Filter: []string{"div"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				macro, _ := selec.Attr("data-macro-name")
+				if macro != "code" && macro != "noformat" {
+					return nil
+				}
+				pre := selec.Find("pre").First()
+				if pre.Length() == 0 {
+					return nil
+				}
+
+				title := strings.TrimSpace(selec.Find(".panelHeader, .codeHeader").First().Text())
+				language := ""
+				if macro == "code" {
+					language = codeLanguage(pre)
+				}
+				return md.String(fencedCode(pre.Text(), language, title))
+			},
+		},
+		{
+			// a code block we somehow found outside its panel.
+			Filter: []string{"pre"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				if !selec.HasClass("syntaxhighlighter-pre") {
+					return nil
+				}
+				return md.String(fencedCode(selec.Text(), codeLanguage(selec), ""))
+			},
+		},
+	}
+}
+
+// codeLanguage reads the language from data-syntaxhighlighter-params="brush: go; gutter: false".
+func codeLanguage(pre *goquery.Selection) string {
+	params, _ := pre.Attr("data-syntaxhighlighter-params")
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(param, ":")
+		if !ok || strings.TrimSpace(key) != "brush" {
+			continue
+		}
+		brush := strings.ToLower(strings.TrimSpace(value))
+		if language, ok := codeBrushLanguages[brush]; ok {
+			return language
+		}
+		return brush
+	}
+	return ""
+}
+
+// fencedCode renders code as a fenced block, with its title, if any, as a caption above it.
+func fencedCode(code string, language string, title string) string {
+	caption := ""
+	if title != "" {
+		caption = fmt.Sprintf("**%s**\n\n", escape.MarkdownCharacters(title))
+	}
+	return fmt.Sprintf("\n\n%s%s\n\n", caption, adf.FencedCode(code, language))
+}
@@ -0,0 +1,91 @@
+package localdump
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata with the current output")
+
+// TestMacroGoldenFiles converts each testdata/macros/<name>.html (as a page's view body) and
+// compares the result with <name>.md, which uses the default GitHub admonition style.  If there's
+// a <name>.<style>.md, it's compared with the output in that admonition style, too.  Run with
+// -update to regenerate the golden files after an intended change.
+func TestMacroGoldenFiles(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "macros", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test cases in testdata/macros")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".html")
+		html, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, style := range []AdmonitionStyle{AdmonitionGitHub, AdmonitionMkDocs, AdmonitionDocusaurus} {
+			golden := filepath.Join("testdata", "macros", name+".md")
+			if style != AdmonitionGitHub {
+				golden = filepath.Join("testdata", "macros", name+"."+string(style)+".md")
+				if _, err := os.Stat(golden); os.IsNotExist(err) {
+					continue
+				}
+			}
+
+			t.Run(strings.TrimSuffix(filepath.Base(golden), ".md"), func(t *testing.T) {
+				got := convertView(t, style, string(html))
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != string(want) {
+					t.Errorf("converting %s with %s admonitions:\n--- got ---\n%s\n--- want ---\n%s", input, style, got, want)
+				}
+			})
+		}
+	}
+}
+
+func convertView(t *testing.T, style AdmonitionStyle, html string) string {
+	t.Helper()
+
+	baseURI, _ := url.Parse("https://acme.atlassian.net/wiki")
+	downloader := SpacesDownloader{
+		API:             &confluence.API{BaseURI: baseURI},
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		AdmonitionStyle: style,
+	}
+	page := confluence.Page{
+		ID:          "100",
+		Title:       "Macros",
+		ContentType: confluence.PageContent,
+		Body: confluence.Body{
+			View: &confluence.Storage{Representation: "view", Value: html},
+		},
+	}
+
+	markdown, err := downloader.convertBody(&page, "acme/SPC/100-macros.md", func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return markdown + "\n"
+}
@@ -0,0 +1,212 @@
+package localdump
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+// Mentions link to a user's profile, e.g. /wiki/people/557058:0a1b2c3d?ref=confluence
+var mentionLinkPattern = regexp.MustCompile(`^/wiki/people/([^/]+)$`)
+
+// mentionRule renders links to users as "@Display Name", and tells `mentioned` about each one.
+func (downloader *SpacesDownloader) mentionRule(mentioned func(accountID string)) md.Rule {
+	return md.Rule{
+		Filter: []string{"a"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			accountID := selec.AttrOr("data-account-id", "")
+			if accountID == "" {
+				u, err := url.Parse(selec.AttrOr("href", ""))
+				if err != nil || (u.Host != "" && u.Host != downloader.API.BaseURI.Host) {
+					return nil
+				}
+				m := mentionLinkPattern.FindStringSubmatch(u.Path)
+				if m == nil {
+					return nil
+				}
+				accountID = m[1]
+			}
+
+			mentioned(accountID)
+			return md.String(escape.MarkdownCharacters(downloader.mentionText(accountID, strings.TrimSpace(selec.Text()))))
+		},
+	}
+}
+
+// mentionText is what we call a mentioned user: "@Display Name", with their email if MentionEmail.
+// If we don't know them, we make do with what Confluence wrote.
+func (downloader *SpacesDownloader) mentionText(accountID string, fallback string) string {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	user, ok := downloader.authorMetadata[accountID]
+	if !ok || user.DisplayName == "" {
+		if fallback == "" {
+			fallback = accountID
+		}
+		if !strings.HasPrefix(fallback, "@") {
+			fallback = "@" + fallback
+		}
+		// so that resolveMentions can find it again.
+		if downloader.mentionFallbacks == nil {
+			downloader.mentionFallbacks = make(map[string]map[string]bool)
+		}
+		if downloader.mentionFallbacks[accountID] == nil {
+			downloader.mentionFallbacks[accountID] = make(map[string]bool)
+		}
+		downloader.mentionFallbacks[accountID][fallback] = true
+		return fallback
+	}
+
+	if downloader.MentionEmail && user.Email != "" {
+		return fmt.Sprintf("@%s (%s)", user.DisplayName, user.Email)
+	}
+	return "@" + user.DisplayName
+}
+
+// mentionHeaders lists mentioned users for the front matter, like the author.  Expects
+// remoteMetadataMu to be held.
+func (downloader *SpacesDownloader) mentionHeaders(accountIDs []string) []string {
+	headers := []string{}
+	for _, id := range accountIDs {
+		if user, ok := downloader.authorMetadata[id]; ok && user.DisplayName != "" {
+			headers = append(headers, fmt.Sprintf("%s <%s>", user.DisplayName, user.Email))
+		} else {
+			headers = append(headers, id)
+		}
+	}
+	return headers
+}
+
+// notePendingMentions remembers where we wrote a page that mentions users we haven't met, so we can
+// fetch them and put their names in once we know them.
+func (downloader *SpacesDownloader) notePendingMentions(page *confluence.Page, markdown LocalMarkdown) {
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	for _, id := range markdown.Mentions {
+		if _, ok := downloader.authorMetadata[id]; ok {
+			continue
+		}
+		if downloader.pendingMentions == nil {
+			downloader.pendingMentions = make(map[ContentID]RelativePath)
+			downloader.unknownMentions = make(map[string]string)
+		}
+		downloader.pendingMentions[markdown.ID] = markdown.RelativePath
+		downloader.unknownMentions[id] = page.Org
+	}
+}
+
+func (downloader *SpacesDownloader) generateMentionFetchJobs() []Job {
+	jobs := []Job{}
+	for id, org := range downloader.unknownMentions {
+		jobs = append(jobs, Job{
+			JobType: UserFetch,
+			Org:     org,
+			GetUserQuery: confluence.GetUserByIDQuery{
+				ID: id,
+			},
+		})
+	}
+	return jobs
+}
+
+// resolveMentions fetches the users that pages mentioned but we didn't know yet, and puts their
+// names in those pages.
+func (downloader *SpacesDownloader) resolveMentions(ctx context.Context) error {
+	if len(downloader.pendingMentions) == 0 {
+		return nil
+	}
+
+	jobs := downloader.generateMentionFetchJobs()
+	downloader.Logger.Info("Fetching mentioned users", "users", len(jobs), "pages", len(downloader.pendingMentions))
+	if err := downloader.channelSoupRun(ctx, jobs, len(jobs), "mentions"); err != nil {
+		return fmt.Errorf("localdump: failed to fetch mentioned users: %w", err)
+	}
+
+	if err := downloader.rewritePendingMentions(); err != nil {
+		return err
+	}
+	downloader.pendingMentions = nil
+	downloader.unknownMentions = nil
+	downloader.mentionFallbacks = nil
+	return nil
+}
+
+// rewritePendingMentions reads back each page that mentions users we've since met, and swaps what
+// we called them for their names, in the front matter and the body.
+func (downloader *SpacesDownloader) rewritePendingMentions() error {
+	if !downloader.WriteMarkdown {
+		// dry run, there's nothing to read back.
+		return nil
+	}
+
+	for id, relativePath := range downloader.pendingMentions {
+		markdown, err := ParseExistingMarkdown(downloader.StorePath, string(relativePath))
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't read back page %s: %w", id, err)
+		}
+		_, body, ok := splitMarkdownFile(markdown.Content)
+		if !ok {
+			return fmt.Errorf("localdump: couldn't find the front matter of %s", relativePath)
+		}
+
+		// the users we wrote down by account ID, for want of a name, and know now.
+		downloader.remoteMetadataMu.Lock()
+		resolved := []string{}
+		for i, accountID := range markdown.Header.Mentions {
+			if user, ok := downloader.authorMetadata[accountID]; ok && user.DisplayName != "" {
+				markdown.Header.Mentions[i] = downloader.mentionHeaders([]string{accountID})[0]
+				resolved = append(resolved, accountID)
+			}
+		}
+		downloader.remoteMetadataMu.Unlock()
+		if len(resolved) == 0 {
+			continue
+		}
+
+		// all in one go, longest first, so that "@Alex" doesn't eat into another user's "@Alex Smith".
+		fallbacks := []string{}
+		names := make(map[string]string)
+		for _, accountID := range resolved {
+			name := escape.MarkdownCharacters(downloader.mentionText(accountID, ""))
+			for fallback := range downloader.mentionFallbacks[accountID] {
+				fallbacks = append(fallbacks, escape.MarkdownCharacters(fallback))
+				names[escape.MarkdownCharacters(fallback)] = name
+			}
+		}
+		slices.SortFunc(fallbacks, func(a, b string) int {
+			if len(a) != len(b) {
+				return cmp.Compare(len(b), len(a))
+			}
+			return strings.Compare(a, b)
+		})
+		replacements := []string{}
+		for _, fallback := range fallbacks {
+			replacements = append(replacements, fallback, names[fallback])
+		}
+		body = strings.NewReplacer(replacements...).Replace(body)
+		header, err := markdownHeaderYAML(markdown.Header)
+		if err != nil {
+			return err
+		}
+		markdown.Content = markdownFile(header, body)
+
+		if err := downloader.WriteMarkdownIntoLocal(markdown); err != nil {
+			return fmt.Errorf("localdump: failed writing file: %w", err)
+		}
+		downloader.remoteMetadataMu.Lock()
+		downloader.recordWritten(markdown)
+		downloader.remoteMetadataMu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package localdump
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JohannesKaufmann/html-to-markdown/escape"
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+func TestRewritePendingMentions(t *testing.T) {
+	store := t.TempDir()
+	downloader := SpacesDownloader{StorePath: store, WriteMarkdown: true}
+
+	// what we write before we've met the user.
+	header := MarkdownHeader{Title: "On call", Version: 2, ObjectID: 100, ObjectType: "page", Mentions: []string{"557058:ab_cd"}}
+	body := "Ask " + escape.MarkdownCharacters(downloader.mentionText("557058:ab_cd", "")) +
+		" or " + escape.MarkdownCharacters(downloader.mentionText("557058:ab_cd", "Alex")) + "."
+	yamlHeader, err := markdownHeaderYAML(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := LocalMarkdown{ID: "100", RelativePath: "acme/SPC/100-on-call.md", Content: markdownFile(yamlHeader, body)}
+	if err := downloader.WriteMarkdownIntoLocal(markdown); err != nil {
+		t.Fatal(err)
+	}
+	downloader.notePendingMentions(&confluence.Page{Org: "acme"}, LocalMarkdown{ID: "100", RelativePath: markdown.RelativePath, Mentions: header.Mentions})
+
+	downloader.authorMetadata = map[string]confluence.User{
+		"557058:ab_cd": {AccountID: "557058:ab_cd", DisplayName: "Alex Doe", Email: "alex@example.com"},
+	}
+	if err := downloader.rewritePendingMentions(); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ParseExistingMarkdown(store, string(markdown.RelativePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Alex Doe <alex@example.com>"}; !reflect.DeepEqual(written.Header.Mentions, want) {
+		t.Errorf("mentions = %q, want %q", written.Header.Mentions, want)
+	}
+	if _, got, _ := splitMarkdownFile(written.Content); got != "Ask @Alex Doe or @Alex Doe." {
+		t.Errorf("body = %q, want both mentions named", got)
+	}
+	if state, ok := downloader.writtenMarkdown[markdown.RelativePath]; !ok || state.Content != written.Content {
+		t.Errorf("rewritten page wasn't recorded for the state")
+	}
+}
@@ -1,48 +1,225 @@
 package localdump
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/toothbrush/confluence-dump/confluence"
 )
 
+// ErrPruneRefused means pruning would have removed a suspiciously large part of a space.
+var ErrPruneRefused = errors.New("refusing to prune")
+
+// DefaultPruneThreshold is the percentage of a space's pages we're willing to prune in one go.
+const DefaultPruneThreshold = 10.0
+
+// Pruning a handful of files is never suspicious, however small the space.
+const minPruneGuardFiles = 5
+
+type PruneReason string
+
+const (
+	PruneMoved      PruneReason = "moved"            // the page lives somewhere else now
+	PruneDeleted    PruneReason = "deleted remotely" // Confluence didn't list the page
+	PruneUnknown    PruneReason = "unknown ID"       // we can't tell which page this file is
+	PruneAttachment PruneReason = "attachment"       // no longer attached, or its page is gone
+)
+
+type PruneCandidate struct {
+	Path   string // relative to the store
+	ID     ContentID
+	Reason PruneReason
+
+	// if Reason is PruneMoved
+	NewPath RelativePath
+}
+
+// PrunePlan is what pruning a space would do.
+type PrunePlan struct {
+	Space confluence.Space
+
+	// how many pages we have locally, and which files would go.
+	Pages      int
+	Candidates []PruneCandidate
+
+	// pruning this many pages looks like a listing gone wrong.
+	Refused bool
+}
+
+// PrunedPages counts the pages (not attachments) we'd prune.
+func (plan PrunePlan) PrunedPages() int {
+	n := 0
+	for _, c := range plan.Candidates {
+		if c.Reason != PruneAttachment {
+			n++
+		}
+	}
+	return n
+}
+
+// PrunePlans returns what we pruned, or, with PruneDryRun, would have pruned.
+func (downloader *SpacesDownloader) PrunePlans() []PrunePlan {
+	return downloader.prunePlans
+}
+
+// PruneSpaces prunes without downloading anything: only files of pages that Confluence no longer
+// lists, and files we don't recognise, go.  Pages that merely moved are left for the next download
+// to deal with.  With Quarantine, files we can't parse are quarantined rather than pruned.
+func (downloader *SpacesDownloader) PruneSpaces(ctx context.Context, spaces []confluence.Space) error {
+	// only what's already in the store counts: don't write folders, or judge attachments.
+	downloader.listOnly = true
+	if err := downloader.Prepare(ctx, spaces); err != nil {
+		return err
+	}
+
+	downloader.freshLocalFiles = make(map[string]bool)
+	for id, local := range downloader.localMarkdownCache {
+		if _, ok := downloader.remotePageMetadata[id]; ok {
+			downloader.freshLocalFiles[string(local.RelativePath)] = true
+		}
+	}
+	if err := downloader.pruneLocalDB(); err != nil {
+		return fmt.Errorf("localdump: failed to prune: %w", err)
+	}
+	return nil
+}
+
 func (downloader *SpacesDownloader) pruneLocalDB() error {
+	downloader.prunePlans = []PrunePlan{}
+	refused := []string{}
 
 	for _, s := range downloader.spacesMetadata {
-		if err := downloader.pruneSpace(s); err != nil {
-			return fmt.Errorf("localdump.pruneLocalDB: failed to prune space %s", s.Key)
+		plan, err := downloader.planPrune(s)
+		if err != nil {
+			return fmt.Errorf("localdump.pruneLocalDB: failed to plan pruning of space %s: %w", s.Key, err)
+		}
+		downloader.prunePlans = append(downloader.prunePlans, plan)
+
+		if downloader.PruneDryRun {
+			continue
+		}
+		if plan.Refused {
+			downloader.Logger.Warn("🚨 Not pruning: too many pages would go.  Use --force-prune if that's really what you want",
+				"space", s.Key, "pruned", plan.PrunedPages(), "pages", plan.Pages)
+			refused = append(refused, s.Key)
+			continue
 		}
+		if err := downloader.pruneSpace(plan); err != nil {
+			return fmt.Errorf("localdump.pruneLocalDB: failed to prune space %s: %w", s.Key, err)
+		}
+	}
+
+	slices.SortFunc(downloader.prunePlans, func(a, b PrunePlan) int {
+		return strings.Compare(a.Space.Key, b.Space.Key)
+	})
+
+	if !downloader.PruneDryRun {
+		if err := downloader.expireTrash(); err != nil {
+			return fmt.Errorf("localdump.pruneLocalDB: failed to empty old trash: %w", err)
+		}
+	}
+
+	if len(refused) > 0 {
+		slices.Sort(refused)
+		return fmt.Errorf("%w %s: more than %.f%% of pages would go", ErrPruneRefused, strings.Join(refused, ", "), downloader.PruneThreshold)
 	}
 
 	return nil
 }
 
-func (downloader *SpacesDownloader) pruneSpace(space confluence.Space) error {
+func (downloader *SpacesDownloader) planPrune(space confluence.Space) (PrunePlan, error) {
 	spaceDir := path.Join(downloader.StorePath, space.Org, space.Key)
+	plan := PrunePlan{Space: space}
 
 	localFiles, err := ListAllMarkdownFiles(spaceDir)
 	if err != nil {
-		return fmt.Errorf("localdump.pruneSpace: failed to list *.md in: %s", localFiles)
+		return PrunePlan{}, fmt.Errorf("localdump.planPrune: failed to list *.md in: %s", spaceDir)
+	}
+	plan.Pages = len(localFiles)
+
+	attachmentFiles, err := ListAllAttachmentFiles(spaceDir)
+	if err != nil {
+		return PrunePlan{}, fmt.Errorf("localdump.planPrune: failed to list attachments in: %s", spaceDir)
+	}
+
+	localByPath := make(map[string]ContentID, len(downloader.localMarkdownCache))
+	for id, md := range downloader.localMarkdownCache {
+		localByPath[string(md.RelativePath)] = id
 	}
 
-	for _, file := range localFiles {
+	for _, file := range append(localFiles, attachmentFiles...) {
 		relative, err := filepath.Rel(downloader.StorePath, file)
 		if err != nil {
-			return fmt.Errorf("localdump.pruneSpace: failed to get relative path: %w", err)
+			return PrunePlan{}, fmt.Errorf("localdump.planPrune: failed to get relative path: %w", err)
 		}
 
 		if _, ok := downloader.freshLocalFiles[relative]; ok {
 			// file is fresh, skip!
 			continue
 		}
+		if downloader.quarantinedFiles[relative] {
+			// it's broken, not stale: that's for the user to look at.
+			continue
+		}
+
+		if strings.HasSuffix(path.Dir(relative), attachmentsDirSuffix) {
+			// we didn't look at attachments this time around, so keep them as long as their page
+			// is still around.
+			if !downloader.Attachments || downloader.listOnly {
+				if _, ok := downloader.freshLocalFiles[string(pageForAttachmentsDir(path.Dir(relative)))]; ok {
+					continue
+				}
+			}
+			plan.Candidates = append(plan.Candidates, PruneCandidate{Path: relative, Reason: PruneAttachment})
+			continue
+		}
+
+		// if we're here, it's a stale/unknown file.  let's see if we can say why.
+		plan.Candidates = append(plan.Candidates, downloader.pruneCandidate(relative, localByPath))
+	}
+
+	if downloader.PruneThreshold > 0 && !downloader.ForcePrune {
+		pruned := plan.PrunedPages()
+		plan.Refused = pruned > minPruneGuardFiles &&
+			float64(pruned) > float64(plan.Pages)*downloader.PruneThreshold/100
+	}
+
+	return plan, nil
+}
+
+func (downloader *SpacesDownloader) pruneCandidate(relative string, localByPath map[string]ContentID) PruneCandidate {
+	id, ok := localByPath[relative]
+	if !ok {
+		return PruneCandidate{Path: relative, Reason: PruneUnknown}
+	}
+
+	downloader.remoteMetadataMu.Lock()
+	defer downloader.remoteMetadataMu.Unlock()
+
+	remote, ok := downloader.remotePageMetadata[id]
+	if !ok {
+		return PruneCandidate{Path: relative, ID: id, Reason: PruneDeleted}
+	}
+
+	newPath, err := downloader.PagePath(remote.Page)
+	if err != nil {
+		// odd, but it's certainly not here any more.
+		return PruneCandidate{Path: relative, ID: id, Reason: PruneMoved}
+	}
+	return PruneCandidate{Path: relative, ID: id, Reason: PruneMoved, NewPath: newPath}
+}
 
-		// if we're here, it's a stale/unknown file.
-		downloader.Logger.Printf("Pruning: %s\n", relative)
-		if err := os.Remove(file); err != nil {
-			return fmt.Errorf("localdump.pruneSpace: failed to delete: %w", err)
+func (downloader *SpacesDownloader) pruneSpace(plan PrunePlan) error {
+	for _, candidate := range plan.Candidates {
+		// keep it in the trash for a while, in case we got that wrong.
+		downloader.Logger.Info("Pruning", "reason", candidate.Reason, "path", candidate.Path)
+		if err := downloader.trashFile(candidate.Path); err != nil {
+			return fmt.Errorf("localdump.pruneSpace: failed to prune: %w", err)
 		}
 	}
 
@@ -0,0 +1,68 @@
+package localdump
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+func TestPruneQuarantinesBrokenFiles(t *testing.T) {
+	files := map[string]string{
+		"acme/SPC/100-handbook.md": "---\nobject_id: 100\nversion: 3\nobject_type: page\n---\n\nHandbook\n",
+		"acme/SPC/200-broken.md":   "---\nobject_id: [this isn't\n---\n\nBroken\n",
+		"acme/SPC/300-deleted.md":  "---\nobject_id: 300\nversion: 1\nobject_type: page\n---\n\nDeleted\n",
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		store := t.TempDir()
+		for rel, content := range files {
+			if err := os.MkdirAll(path.Dir(path.Join(store, rel)), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path.Join(store, rel), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// what PruneSpaces does, once Prepare has listed the space.
+		downloader := SpacesDownloader{
+			StorePath:     store,
+			Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WriteMarkdown: !dryRun,
+			Quarantine:    true,
+			PruneDryRun:   dryRun,
+			listOnly:      true,
+			spacesMetadata: map[string]confluence.Space{
+				"1": {ID: "1", Key: "SPC", Org: "acme"},
+			},
+			freshLocalFiles: map[string]bool{"acme/SPC/100-handbook.md": true},
+		}
+		if err := downloader.LoadLocalMarkdown(); err != nil {
+			t.Fatalf("dry run %t: LoadLocalMarkdown() = %v", dryRun, err)
+		}
+		if err := downloader.pruneLocalDB(); err != nil {
+			t.Fatalf("dry run %t: pruneLocalDB() = %v", dryRun, err)
+		}
+
+		plans := downloader.PrunePlans()
+		if len(plans) != 1 || len(plans[0].Candidates) != 1 || plans[0].Candidates[0].Path != "acme/SPC/300-deleted.md" {
+			t.Errorf("dry run %t: prune plans = %+v, want only 300-deleted.md", dryRun, plans)
+		}
+
+		quarantined := path.Join(store, stateDirName, quarantineDirName, "acme/SPC/200-broken.md")
+		_, err := os.Stat(quarantined)
+		if dryRun && err == nil {
+			t.Errorf("dry run quarantined %s", quarantined)
+		}
+		if !dryRun && err != nil {
+			t.Errorf("broken file wasn't quarantined: %v", err)
+		}
+		if _, err := os.Stat(path.Join(store, "acme/SPC/200-broken.md")); dryRun != (err == nil) {
+			t.Errorf("dry run %t: broken file in the store: %v", dryRun, err)
+		}
+	}
+}
@@ -13,6 +13,13 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// ErrBrokenMarkdown means a file in the store doesn't have a header we understand, for example
+// because a crash left it truncated.
+var ErrBrokenMarkdown = errors.New("broken Markdown file")
+
+// Files we can't parse end up here, inside stateDirName.
+const quarantineDirName = "quarantine"
+
 func ParseExistingMarkdown(storePath string, relativePath string) (LocalMarkdown, error) {
 	fullPath := path.Join(storePath, relativePath)
 	source, err := os.ReadFile(fullPath)
@@ -25,12 +32,12 @@ func ParseExistingMarkdown(storePath string, relativePath string) (LocalMarkdown
 
 	// we expect the first "document" to be our header YAML.
 	if err := d.Decode(&header); err != nil {
-		return LocalMarkdown{}, fmt.Errorf("localdump: couldn't parse header of file %s: %w", fullPath, err)
+		return LocalMarkdown{}, fmt.Errorf("localdump: %w: couldn't parse header of file %s: %v", ErrBrokenMarkdown, fullPath, err)
 	}
 	// check it was parsed
 	if header.ObjectID < 1 ||
 		header.Version < 1 {
-		return LocalMarkdown{}, fmt.Errorf("localdump: header seems broken in %s", fullPath)
+		return LocalMarkdown{}, fmt.Errorf("localdump: %w: header seems broken in %s", ErrBrokenMarkdown, fullPath)
 	}
 
 	ancestorIDs := []ContentID{}
@@ -44,6 +51,8 @@ func ParseExistingMarkdown(storePath string, relativePath string) (LocalMarkdown
 		RelativePath: RelativePath(relativePath),
 		Version:      header.Version,
 		AncestorIDs:  ancestorIDs,
+		Attachments:  header.Attachments,
+		Header:       header,
 	}, nil
 }
 
@@ -54,7 +63,11 @@ func (downloader *SpacesDownloader) LoadLocalMarkdown() error {
 		return fmt.Errorf("localdump: error loading Markdown files: %w", err)
 	}
 
+	// files that haven't changed since we recorded them in the state needn't be parsed again.
+	known := downloader.state.pagesByPath()
+
 	downloader.localMarkdownCache = make(map[ContentID]LocalMarkdown)
+	downloader.quarantinedFiles = make(map[string]bool)
 	// parse each file
 	for _, file := range filenames {
 		rel, err := filepath.Rel(downloader.StorePath, file)
@@ -62,9 +75,18 @@ func (downloader *SpacesDownloader) LoadLocalMarkdown() error {
 			return fmt.Errorf("localdump: couldn't compute relative path of %s: %w", file, err)
 		}
 
-		md, err := ParseExistingMarkdown(downloader.StorePath, rel)
+		md, err := downloader.loadLocalMarkdownFile(known, file, rel)
+		if errors.Is(err, ErrBrokenMarkdown) && downloader.Quarantine {
+			// move it out of the way; we'll download a fresh copy.
+			if err := downloader.quarantine(rel); err != nil {
+				return err
+			}
+			downloader.quarantinedFiles[rel] = true
+			downloader.Logger.Warn("Quarantined", "path", rel, "error", err)
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("localdump: couldn't load local Markdown file %s: %w", file, err)
+			return err
 		}
 
 		if _, ok := downloader.localMarkdownCache[md.ID]; ok {
@@ -77,6 +99,47 @@ func (downloader *SpacesDownloader) LoadLocalMarkdown() error {
 	return nil
 }
 
+func (downloader *SpacesDownloader) loadLocalMarkdownFile(known map[RelativePath]ContentID, file, rel string) (LocalMarkdown, error) {
+	if id, ok := known[RelativePath(rel)]; ok {
+		info, err := os.Stat(file)
+		if err != nil {
+			return LocalMarkdown{}, fmt.Errorf("localdump: couldn't stat %s: %w", file, err)
+		}
+		if page := downloader.state.Pages[id]; page.matches(info) {
+			return page.localMarkdown(id), nil
+		}
+	}
+
+	md, err := ParseExistingMarkdown(downloader.StorePath, rel)
+	if err != nil {
+		return LocalMarkdown{}, fmt.Errorf("localdump: couldn't load local Markdown file %s: %w", file, err)
+	}
+	return md, nil
+}
+
+// quarantine moves an unparseable file from the store into our bookkeeping directory, where it
+// won't bother us, but the user can still have a look.
+func (downloader *SpacesDownloader) quarantine(rel string) error {
+	if !downloader.WriteMarkdown {
+		// dry run
+		return nil
+	}
+
+	return quarantineFile(downloader.StorePath, rel)
+}
+
+func quarantineFile(storePath, rel string) error {
+	from := path.Join(storePath, rel)
+	to := path.Join(storePath, stateDirName, quarantineDirName, rel)
+	if err := os.MkdirAll(path.Dir(to), 0750); err != nil {
+		return fmt.Errorf("localdump: couldn't create directory %s: %w", path.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("localdump: couldn't quarantine %s: %w", from, err)
+	}
+	return nil
+}
+
 // returns absolute pathnames
 func ListAllMarkdownFiles(inFolder string) ([]string, error) {
 	if _, err := os.Stat(inFolder); err == nil {
@@ -96,6 +159,14 @@ func ListAllMarkdownFiles(inFolder string) ([]string, error) {
 			if err != nil {
 				return fmt.Errorf("localdump: error during file tree walk: %w", err)
 			}
+			if info.IsDir() && info.Name() == stateDirName {
+				// that's our bookkeeping, not content.
+				return filepath.SkipDir
+			}
+			if info.IsDir() && strings.HasSuffix(path, attachmentsDirSuffix) {
+				// attachments aren't pages, even if they happen to be Markdown files.
+				return filepath.SkipDir
+			}
 			if !info.IsDir() && strings.HasSuffix(path, ".md") {
 				filenames = append(filenames, path)
 			}
@@ -109,14 +180,24 @@ func ListAllMarkdownFiles(inFolder string) ([]string, error) {
 }
 
 type MarkdownHeader struct {
-	Title         string
-	Timestamp     time.Time
-	Version       int
-	Author        string
-	ObjectID      int `yaml:"object_id"`
-	URI           string
-	Status        string
-	ObjectType    string   `yaml:"object_type"`
-	AncestorNames []string `yaml:"ancestor_names,flow"`
-	AncestorIDs   []int    `yaml:"ancestor_ids,flow"`
+	Title         string    `json:"title"`
+	Timestamp     time.Time `json:"timestamp"`
+	Version       int       `json:"version"`
+	Author        string    `json:"author"`
+	ObjectID      int       `yaml:"object_id" json:"object_id"`
+	URI           string    `json:"uri"`
+	Status        string    `json:"status"`
+	ObjectType    string    `yaml:"object_type" json:"object_type"`
+	AncestorNames []string  `yaml:"ancestor_names,flow" json:"ancestor_names"`
+	AncestorIDs   []int     `yaml:"ancestor_ids,flow" json:"ancestor_ids"`
+
+	Attachments []AttachmentRef `yaml:"attachments,omitempty" json:"attachments,omitempty"`
+	Mentions    []string        `yaml:"mentions,omitempty" json:"mentions,omitempty"`
+}
+
+// AttachmentRef records an attachment we've downloaded alongside a page.
+type AttachmentRef struct {
+	ID      string `yaml:"id" json:"id"`
+	Version int    `yaml:"version" json:"version"`
+	File    string `yaml:"file" json:"file"` // relative to the store
 }
@@ -0,0 +1,207 @@
+package localdump
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+type ReportAction string
+
+const (
+	ActionCreated ReportAction = "created"
+	ActionUpdated ReportAction = "updated"
+	ActionMoved   ReportAction = "moved"
+	ActionSkipped ReportAction = "skipped" // our copy was up to date
+	ActionPruned  ReportAction = "pruned"
+	ActionFailed  ReportAction = "failed"
+)
+
+// PageOutcome is what a run did with one page.
+type PageOutcome struct {
+	ID     ContentID    `json:"id"`
+	Space  string       `json:"space"`
+	Title  string       `json:"title"`
+	Action ReportAction `json:"action"`
+
+	OldVersion int          `json:"old_version,omitempty"` // unless created
+	NewVersion int          `json:"new_version,omitempty"` // unless pruned or failed
+	OldPath    RelativePath `json:"old_path,omitempty"`
+	NewPath    RelativePath `json:"new_path,omitempty"`
+
+	// if ActionFailed
+	Error string `json:"error,omitempty"`
+}
+
+// PhaseReport is how long a phase of the run took, and how hard it worked Confluence.
+type PhaseReport struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
+	Jobs     int           `json:"jobs"`
+	Requests int64         `json:"requests"`
+}
+
+// Report is a machine-readable account of a run.
+type Report struct {
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration_ns"`
+	Spaces   []string      `json:"spaces"`
+	Requests int64         `json:"requests"`
+
+	Phases []PhaseReport  `json:"phases"`
+	Pages  []PageOutcome  `json:"pages"`
+	Counts map[string]int `json:"counts"`
+}
+
+// Report describes what this run did to every page, and where the time went.
+func (downloader *SpacesDownloader) Report() Report {
+	report := Report{
+		Started:  downloader.runStarted,
+		Finished: time.Now(),
+		Spaces:   []string{},
+		Counts:   make(map[string]int),
+	}
+	report.Duration = report.Finished.Sub(report.Started)
+	if downloader.API != nil {
+		report.Requests = downloader.API.Requests()
+	}
+	for _, space := range downloader.spacesMetadata {
+		report.Spaces = append(report.Spaces, space.Key)
+	}
+	slices.Sort(report.Spaces)
+
+	downloader.remoteMetadataMu.Lock()
+	report.Phases = slices.Clone(downloader.phases)
+	pages := slices.Clone(downloader.outcomes)
+	downloader.remoteMetadataMu.Unlock()
+
+	for _, failure := range downloader.Failures() {
+		if failure.IsAttachment() {
+			// attachments aren't pages; they're counted, and the failure report has the details.
+			report.Counts["attachments_failed"]++
+			continue
+		}
+		outcome := PageOutcome{
+			ID:     failure.ID,
+			Space:  failure.SpaceKey,
+			Title:  failure.Title,
+			Action: ActionFailed,
+			Error:  failure.Error,
+		}
+		if local, ok := downloader.localMarkdownCache[failure.ID]; ok {
+			outcome.OldVersion = local.Version
+			outcome.OldPath = local.RelativePath
+		}
+		pages = append(pages, outcome)
+	}
+
+	for _, plan := range downloader.prunePlans {
+		if plan.Refused || downloader.PruneDryRun {
+			continue
+		}
+		for _, c := range plan.Candidates {
+			if c.Reason != PruneDeleted && c.Reason != PruneUnknown {
+				// moved pages were reported as such, and attachments aren't pages.
+				continue
+			}
+			outcome := PageOutcome{
+				ID:      c.ID,
+				Space:   plan.Space.Key,
+				Action:  ActionPruned,
+				OldPath: RelativePath(c.Path),
+			}
+			if local, ok := downloader.localMarkdownCache[c.ID]; ok {
+				outcome.Title = local.Header.Title
+				outcome.OldVersion = local.Version
+			}
+			pages = append(pages, outcome)
+		}
+	}
+
+	slices.SortFunc(pages, func(a, b PageOutcome) int {
+		if c := strings.Compare(a.Space, b.Space); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.path()), string(b.path()))
+	})
+	for _, page := range pages {
+		report.Counts[string(page.Action)]++
+	}
+	report.Pages = pages
+
+	return report
+}
+
+func (outcome PageOutcome) path() RelativePath {
+	if outcome.NewPath != "" {
+		return outcome.NewPath
+	}
+	return outcome.OldPath
+}
+
+// recordOutcome notes what happened to a page we fetched, or didn't need to.  Expects
+// remoteMetadataMu to be held.
+func (downloader *SpacesDownloader) recordOutcome(md LocalMarkdown, spaceKey string, outcome DownloadAction) {
+	if md.Header.ObjectType == confluence.FolderContent.String() {
+		return
+	}
+
+	page := PageOutcome{
+		ID:         md.ID,
+		Space:      spaceKey,
+		Title:      md.Header.Title,
+		Action:     ActionCreated,
+		NewVersion: md.Header.Version,
+		NewPath:    md.RelativePath,
+	}
+	if old, ok := downloader.localMarkdownCache[md.ID]; ok {
+		page.OldVersion = old.Version
+		page.OldPath = old.RelativePath
+		switch {
+		case outcome == SkippedCached:
+			page.Action = ActionSkipped
+		case old.RelativePath != md.RelativePath:
+			page.Action = ActionMoved
+		default:
+			page.Action = ActionUpdated
+		}
+	}
+
+	downloader.outcomes = append(downloader.outcomes, page)
+}
+
+// startPhase notes the start of a phase of the run; call the returned function when it's done.
+// Phases of the same name, like the rounds of folder fetching, add up.
+func (downloader *SpacesDownloader) startPhase(name string, jobs int) func() {
+	started := time.Now()
+	var requests int64
+	if downloader.API != nil {
+		requests = downloader.API.Requests()
+	}
+
+	return func() {
+		phase := PhaseReport{
+			Name:     name,
+			Duration: time.Since(started),
+			Jobs:     jobs,
+		}
+		if downloader.API != nil {
+			phase.Requests = downloader.API.Requests() - requests
+		}
+
+		downloader.remoteMetadataMu.Lock()
+		defer downloader.remoteMetadataMu.Unlock()
+		for i, p := range downloader.phases {
+			if p.Name == name {
+				downloader.phases[i].Duration += phase.Duration
+				downloader.phases[i].Jobs += phase.Jobs
+				downloader.phases[i].Requests += phase.Requests
+				return
+			}
+		}
+		downloader.phases = append(downloader.phases, phase)
+	}
+}
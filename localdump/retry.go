@@ -0,0 +1,88 @@
+package localdump
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how often, and how patiently, we retry jobs that failed with a transient
+// error (see confluence.IsRetryable).  Anything else fails the run straight away.
+type RetryPolicy struct {
+	// How many times we'll try a job in total, including the first attempt.
+	MaxAttempts int
+	// Delay before the first retry; it doubles with each subsequent retry...
+	BaseDelay time.Duration
+	// ...up to this ceiling.
+	MaxDelay time.Duration
+
+	// How many times a job may be throttled before we give up on it.  Throttling doesn't count
+	// against MaxAttempts, because we wait for as long as Confluence tells us to.
+	MaxThrottled int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	BaseDelay:    500 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+	MaxThrottled: 20,
+}
+
+// backoff returns how long to wait before retry number `retry` (counting from 1).  We use "equal
+// jitter", so that a bunch of workers that failed at the same moment (say, because the VPN dropped)
+// don't all come back at the same moment too:
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := retry - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		ceiling = p.BaseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	half := ceiling / 2
+	return half + time.Duration(rand.Int63n(int64(ceiling-half)+1))
+}
+
+func (downloader *SpacesDownloader) retryPolicy() RetryPolicy {
+	policy := downloader.Retry
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if policy.MaxThrottled < 1 {
+		policy.MaxThrottled = DefaultRetryPolicy.MaxThrottled
+	}
+	return policy
+}
+
+func (j Job) String() string {
+	switch j.JobType {
+	case PagesList:
+		return fmt.Sprintf("listing of %s", j.SpaceKey)
+	case PagesSearch:
+		return fmt.Sprintf("search for changes in %s", j.SpaceKey)
+	case PageFetch:
+		return fmt.Sprintf("%s %s in %s", j.ContentType, j.PageID, j.SpaceKey)
+	case UserFetch:
+		return fmt.Sprintf("user %s", j.GetUserQuery.ID)
+	case FolderFetch:
+		return fmt.Sprintf("folder %d in %s", j.FolderID, j.SpaceKey)
+	case AttachmentsList:
+		return fmt.Sprintf("attachment listing of %s %s", j.ContentType, j.PageID)
+	case AttachmentFetch:
+		return fmt.Sprintf("attachment %s of %s %s", j.Attachment.ID, j.ContentType, j.PageID)
+	case VersionsList:
+		return fmt.Sprintf("version listing of %s %s", j.ContentType, j.PageID)
+	case VersionFetch:
+		return fmt.Sprintf("version %d of %s %s", j.Version, j.ContentType, j.PageID)
+	default:
+		return fmt.Sprintf("job type %d", j.JobType)
+	}
+}
@@ -0,0 +1,106 @@
+package localdump
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SlugStyle decides which characters of a title survive into its slug.
+type SlugStyle string
+
+const (
+	// Transliterate to plain [a-z0-9-], e.g. "Über Straße" -> "uber-strasse", "Привет" -> "privet".
+	SlugASCII SlugStyle = "ascii"
+	// Keep letters and digits from any script, e.g. "設計 ドキュメント" -> "設計-ドキュメント".
+	SlugUnicode SlugStyle = "unicode"
+)
+
+const maxSlugLength = 100
+
+func ParseSlugStyle(s string) (SlugStyle, error) {
+	switch SlugStyle(s) {
+	case SlugASCII, SlugUnicode:
+		return SlugStyle(s), nil
+	case "":
+		return SlugASCII, nil
+	}
+	return "", fmt.Errorf("localdump: unknown slug style '%s', expected %s or %s", s, SlugASCII, SlugUnicode)
+}
+
+// slugFor returns the slug for an object's file or directory name.  If the title has nothing we
+// can use (say, it's all emoji), we fall back to a slug based on the object's ID, which is just as
+// stable across runs.
+func (downloader *SpacesDownloader) slugFor(page confluence.Page) string {
+	if slug, err := canonicalise(page.Title, downloader.SlugStyle); err == nil {
+		return slug
+	}
+	return fmt.Sprintf("%s-%s", page.ContentType, page.ID)
+}
+
+func canonicalise(title string, style SlugStyle) (string, error) {
+	var b strings.Builder
+	// decompose, so that accents become separate marks we can drop (or keep, for unicode slugs).
+	for _, r := range norm.NFKD.String(title) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.Is(unicode.Mn, r):
+			if style == SlugUnicode {
+				b.WriteRune(r)
+			}
+		case style == SlugUnicode && (unicode.IsLetter(r) || unicode.IsNumber(r)):
+			b.WriteRune(unicode.ToLower(r))
+		case style != SlugUnicode && transliterable(r):
+			b.WriteString(transliterations[unicode.ToLower(r)])
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	// recompose, so the slug doesn't change depending on how the title happened to be encoded.
+	fields := strings.Fields(norm.NFC.String(b.String()))
+	str := strings.Join(fields, "-")
+
+	if runes := []rune(str); len(runes) > maxSlugLength+1 {
+		str = string(runes[:maxSlugLength])
+	}
+
+	str = strings.Trim(str, "-")
+
+	if len([]rune(str)) < 2 {
+		return "", fmt.Errorf("localdump: slug too short: title was '%s'", title)
+	}
+
+	return str, nil
+}
+
+func transliterable(r rune) bool {
+	_, ok := transliterations[unicode.ToLower(r)]
+	return ok
+}
+
+// transliterations covers letters that don't decompose into ASCII plus accents.  It's far from
+// exhaustive: scripts like CJK have no sensible romanisation without a dictionary, so titles in
+// those end up with an ID-based slug unless you use SlugUnicode.
+var transliterations = map[rune]string{
+	// Latin odds and ends
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th", 'ł': "l", 'ı': "i",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh",
+	'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj",
+	'ћ': "c", 'џ': "dz",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+}
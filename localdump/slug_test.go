@@ -0,0 +1,121 @@
+package localdump
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+func TestCanonicalise(t *testing.T) {
+	tests := []struct {
+		title   string
+		ascii   string
+		unicode string
+	}{
+		{"Team Handbook", "team-handbook", "team-handbook"},
+		{"  --Hello,   World!--  ", "hello-world", "hello-world"},
+		{"Café", "cafe", "café"},
+		{"Über Straße", "uber-strasse", "über-straße"},
+		{"Ærøskøbing", "aeroskobing", "ærøskøbing"},
+		{"ﬁle naming", "file-naming", "file-naming"},
+		{"Привет мир", "privet-mir", "привет-мир"},
+		{"Ελληνικά", "ellinika", "ελληνικά"},
+		{"設計 ドキュメント", "", "設計-ドキュメント"},
+		{"Release 2024 🚀", "release-2024", "release-2024"},
+		{"🎉🚀", "", ""},
+		{"a", "", ""},
+		{"---", "", ""},
+		{strings.Repeat("ab ", 60), strings.Repeat("ab-", 33) + "a", strings.Repeat("ab-", 33) + "a"},
+	}
+
+	for _, tt := range tests {
+		for style, want := range map[SlugStyle]string{SlugASCII: tt.ascii, SlugUnicode: tt.unicode} {
+			got, err := canonicalise(tt.title, style)
+			if want == "" {
+				if err == nil {
+					t.Errorf("canonicalise(%q, %s) = %q, want an error", tt.title, style, got)
+				}
+				continue
+			}
+			if err != nil || got != want {
+				t.Errorf("canonicalise(%q, %s) = %q, %v, want %q", tt.title, style, got, err, want)
+			}
+		}
+	}
+}
+
+func TestCanonicaliseIsStable(t *testing.T) {
+	// the same title, however it happens to be encoded, gets the same slug.
+	for _, style := range []SlugStyle{SlugASCII, SlugUnicode} {
+		composed, _ := canonicalise("Caf\u00e9 cr\u00e8me", style)
+		decomposed, _ := canonicalise("Cafe\u0301 cre\u0300me", style)
+		if composed != decomposed {
+			t.Errorf("%s: composed title gives %q, decomposed gives %q", style, composed, decomposed)
+		}
+	}
+
+	// plain ASCII titles keep the slugs they had before Unicode-aware slugs, so upgrading doesn't
+	// move any of their files.
+	legacy := func(title string) string {
+		str := regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(title, " ")
+		str = strings.Join(strings.Fields(strings.ToLower(str)), "-")
+		if len(str) > 101 {
+			str = str[:100]
+		}
+		return strings.Trim(str, "-")
+	}
+	for _, title := range []string{
+		"Team Handbook",
+		"How-to: deploy (v2) & roll back",
+		"FAQ -- 2024/25",
+		"snake_case_title",
+		"  leading and trailing  ",
+		"CamelCase123",
+		strings.Repeat("word ", 30),
+	} {
+		for _, style := range []SlugStyle{SlugASCII, SlugUnicode} {
+			if got, _ := canonicalise(title, style); got != legacy(title) {
+				t.Errorf("canonicalise(%q, %s) = %q, but it used to be %q", title, style, got, legacy(title))
+			}
+		}
+	}
+}
+
+func TestSlugFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  confluence.Page
+		style SlugStyle
+		want  string
+	}{
+		{"title", confluence.Page{ID: "1", Title: "Café", ContentType: confluence.PageContent}, SlugASCII, "cafe"},
+		{"unicode title", confluence.Page{ID: "1", Title: "Café", ContentType: confluence.PageContent}, SlugUnicode, "café"},
+		{"CJK page", confluence.Page{ID: "42", Title: "設計", ContentType: confluence.PageContent}, SlugASCII, "page-42"},
+		{"CJK page, kept", confluence.Page{ID: "42", Title: "設計", ContentType: confluence.PageContent}, SlugUnicode, "設計"},
+		{"emoji blog post", confluence.Page{ID: "7", Title: "🎉", ContentType: confluence.BlogContent}, SlugUnicode, "blogpost-7"},
+		{"emoji folder", confluence.Page{ID: "9", Title: "📁 📁", ContentType: confluence.FolderContent}, SlugASCII, "folder-9"},
+		{"untitled", confluence.Page{ID: "3", ContentType: confluence.PageContent}, SlugASCII, "page-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downloader := SpacesDownloader{SlugStyle: tt.style}
+			if got := downloader.slugFor(tt.page); got != tt.want {
+				t.Errorf("slugFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSlugStyle(t *testing.T) {
+	for input, want := range map[string]SlugStyle{"": SlugASCII, "ascii": SlugASCII, "unicode": SlugUnicode} {
+		if got, err := ParseSlugStyle(input); err != nil || got != want {
+			t.Errorf("ParseSlugStyle(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseSlugStyle("emoji"); err == nil {
+		t.Error("ParseSlugStyle(\"emoji\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,241 @@
+package localdump
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+// We keep our own bookkeeping in this directory inside the store.
+const stateDirName = ".confluence-dump"
+
+const (
+	stateFile    = "state.json"
+	stateVersion = 1
+)
+
+// State is our manifest of the local store: what we synced when, which page lives where, and
+// who wrote what.  It lets us start up without parsing every Markdown file, and gives features
+// like incremental sync somewhere to keep their cursors.
+//
+// The Markdown files remain the source of truth, though: if a file doesn't look like it did when we
+// recorded it, we'll parse it again.
+type State struct {
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// keyed by spaceStateKey
+	Spaces map[string]SpaceState `json:"spaces"`
+
+	Pages map[ContentID]PageState `json:"pages"`
+
+	// keyed by account ID
+	Users map[string]confluence.User `json:"users"`
+}
+
+type SpaceState struct {
+	ID   string `json:"id"`
+	Org  string `json:"org"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+
+	LastSync     time.Time `json:"last_sync"`
+	LastFullSync time.Time `json:"last_full_sync"`
+}
+
+type PageState struct {
+	Path   RelativePath   `json:"path"`
+	Header MarkdownHeader `json:"header"`
+
+	// to tell whether the file has been touched since we recorded it.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func spaceStateKey(space confluence.Space) string {
+	return path.Join(space.Org, space.Key)
+}
+
+func newState() State {
+	return State{
+		Version: stateVersion,
+		Spaces:  make(map[string]SpaceState),
+		Pages:   make(map[ContentID]PageState),
+		Users:   make(map[string]confluence.User),
+	}
+}
+
+// LoadState reads the manifest from the store.  If there isn't one yet, that's fine, you get an
+// empty state.
+func LoadState(storePath string) (State, error) {
+	state := newState()
+
+	filename := path.Join(storePath, stateDirName, stateFile)
+	contents, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("localdump: couldn't read state: %w", err)
+	}
+
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return State{}, fmt.Errorf("localdump: couldn't parse state %s: %w", filename, err)
+	}
+	if state.Version != stateVersion {
+		return State{}, fmt.Errorf("localdump: state %s has version %d, but we only understand version %d", filename, state.Version, stateVersion)
+	}
+
+	if state.Spaces == nil {
+		state.Spaces = make(map[string]SpaceState)
+	}
+	if state.Pages == nil {
+		state.Pages = make(map[ContentID]PageState)
+	}
+	if state.Users == nil {
+		state.Users = make(map[string]confluence.User)
+	}
+
+	return state, nil
+}
+
+// Save writes the state into the store.
+func (state State) Save(storePath string) error {
+	state.Version = stateVersion
+	state.UpdatedAt = time.Now()
+
+	return writeBookkeeping(storePath, stateFile, state)
+}
+
+// writeBookkeeping writes v as JSON into our bookkeeping directory.
+func writeBookkeeping(storePath string, name string, v any) error {
+	dir := path.Join(storePath, stateDirName)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("localdump: couldn't create directory %s: %w", dir, err)
+	}
+
+	contents, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't marshal %s: %w", name, err)
+	}
+
+	return atomicWriteFile(path.Join(dir, name), append(contents, '\n'), 0644)
+}
+
+// pagesByPath indexes the recorded pages by where they live.
+func (state State) pagesByPath() map[RelativePath]ContentID {
+	byPath := make(map[RelativePath]ContentID, len(state.Pages))
+	for id, page := range state.Pages {
+		byPath[page.Path] = id
+	}
+	return byPath
+}
+
+// localMarkdown reconstructs what ParseExistingMarkdown would have told us, minus the contents.
+func (page PageState) localMarkdown(id ContentID) LocalMarkdown {
+	ancestorIDs := []ContentID{}
+	for _, ancestor := range page.Header.AncestorIDs {
+		ancestorIDs = append(ancestorIDs, ContentID(fmt.Sprintf("%d", ancestor)))
+	}
+
+	return LocalMarkdown{
+		ID:           id,
+		RelativePath: page.Path,
+		Version:      page.Header.Version,
+		AncestorIDs:  ancestorIDs,
+		Attachments:  page.Header.Attachments,
+		Header:       page.Header,
+	}
+}
+
+// matches tells us whether a file is still the way it was when we recorded it.
+func (page PageState) matches(info os.FileInfo) bool {
+	return page.Size == info.Size() && page.ModTime.Equal(info.ModTime())
+}
+
+// saveState records the current contents of the store.  Sync cursors only move forward if the sync
+// was complete.
+func (downloader *SpacesDownloader) saveState(syncComplete bool) error {
+	state := downloader.state
+	if state.Pages == nil {
+		state = newState()
+	}
+
+	filenames, err := ListAllMarkdownFiles(downloader.StorePath)
+	if err != nil {
+		return fmt.Errorf("localdump: error listing Markdown files: %w", err)
+	}
+
+	localByPath := make(map[RelativePath]LocalMarkdown, len(downloader.localMarkdownCache))
+	for _, md := range downloader.localMarkdownCache {
+		localByPath[md.RelativePath] = md
+	}
+
+	pages := make(map[ContentID]PageState, len(filenames))
+	for _, file := range filenames {
+		rel, err := filepath.Rel(downloader.StorePath, file)
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't compute relative path of %s: %w", file, err)
+		}
+
+		md, ok := downloader.writtenMarkdown[RelativePath(rel)]
+		if !ok {
+			md, ok = localByPath[RelativePath(rel)]
+		}
+		if !ok {
+			// not ours, or somebody dropped it in during the run.  we'll find out next time.
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("localdump: couldn't stat %s: %w", file, err)
+		}
+
+		pages[md.ID] = PageState{
+			Path:    md.RelativePath,
+			Header:  md.Header,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+	}
+	state.Pages = pages
+
+	for id, user := range downloader.authorMetadata {
+		state.Users[id] = user
+	}
+
+	for id, space := range downloader.spacesMetadata {
+		key := spaceStateKey(space)
+		spaceState := state.Spaces[key]
+		spaceState.ID = space.ID
+		spaceState.Org = space.Org
+		spaceState.Key = space.Key
+		spaceState.Name = space.Name
+
+		if syncComplete {
+			spaceState.LastSync = downloader.runStarted
+			if _, incremental := downloader.incrementalSince[id]; !incremental {
+				spaceState.LastFullSync = downloader.runStarted
+			}
+		}
+		state.Spaces[key] = spaceState
+	}
+
+	downloader.state = state
+	return state.Save(downloader.StorePath)
+}
+
+// recordWritten notes a page we wrote this run.  Expects remoteMetadataMu to be held.
+func (downloader *SpacesDownloader) recordWritten(md LocalMarkdown) {
+	if downloader.writtenMarkdown == nil {
+		downloader.writtenMarkdown = make(map[RelativePath]LocalMarkdown)
+	}
+	downloader.writtenMarkdown[md.RelativePath] = md
+}
@@ -0,0 +1,175 @@
+package localdump
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+type StatusKind string
+
+const (
+	StatusNew     StatusKind = "new"     // we don't have it yet
+	StatusUpdated StatusKind = "updated" // edited since we downloaded it
+	StatusMoved   StatusKind = "moved"   // same version, but an ancestor was renamed or it moved
+	StatusPrune   StatusKind = "prune"   // a file that would go to the trash
+)
+
+// PageStatus is what a download would do to one page (or, for StatusPrune, file).
+type PageStatus struct {
+	ID     ContentID  `json:"id,omitempty"`
+	Title  string     `json:"title,omitempty"`
+	Status StatusKind `json:"status"`
+
+	LocalVersion  int `json:"local_version,omitempty"`
+	RemoteVersion int `json:"remote_version,omitempty"`
+
+	OldPath RelativePath `json:"old_path,omitempty"` // unless new
+	NewPath RelativePath `json:"new_path,omitempty"` // unless pruned
+
+	// if StatusPrune
+	Reason PruneReason `json:"reason,omitempty"`
+}
+
+// SpaceStatus is what a download would do to a space.
+type SpaceStatus struct {
+	Space     string       `json:"space"`
+	Pages     []PageStatus `json:"pages"`
+	Unchanged int          `json:"unchanged"`
+
+	// pruning would be refused, see PruneThreshold.
+	PruneRefused bool `json:"prune_refused,omitempty"`
+}
+
+// Status works out what downloading the given spaces would do, without fetching any page bodies or
+// touching the store.  This always does a full listing: an incremental one can't tell us what was
+// deleted.
+func (downloader *SpacesDownloader) Status(ctx context.Context, spaces []confluence.Space) ([]SpaceStatus, error) {
+	downloader.WriteMarkdown = false
+	downloader.Incremental = false
+	// we don't list attachments, so don't hold that against anyone.
+	downloader.Attachments = false
+
+	if err := downloader.Prepare(ctx, spaces); err != nil {
+		return nil, err
+	}
+
+	bySpace := make(map[string]*SpaceStatus)
+	for _, space := range downloader.spacesMetadata {
+		bySpace[space.Key] = &SpaceStatus{Space: space.Key, Pages: []PageStatus{}}
+	}
+
+	for id, remote := range downloader.remotePageMetadata {
+		if remote.Page.ContentType == confluence.FolderContent || downloader.hasFailed(id) {
+			continue
+		}
+		space, ok := bySpace[remote.Page.SpaceKey]
+		if !ok {
+			return nil, fmt.Errorf("localdump: page %s in unknown space %s", id, remote.Page.SpaceKey)
+		}
+
+		status, unchanged, err := downloader.pageStatus(id, remote)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			space.Unchanged++
+			continue
+		}
+		space.Pages = append(space.Pages, status)
+	}
+
+	// anything Confluence still lists is accounted for above; the rest would be pruned.
+	downloader.freshLocalFiles = make(map[string]bool)
+	for id, local := range downloader.localMarkdownCache {
+		if _, ok := downloader.remotePageMetadata[id]; ok {
+			downloader.freshLocalFiles[string(local.RelativePath)] = true
+		}
+	}
+	for _, space := range downloader.spacesMetadata {
+		plan, err := downloader.planPrune(space)
+		if err != nil {
+			return nil, fmt.Errorf("localdump: failed to plan pruning of space %s: %w", space.Key, err)
+		}
+		status := bySpace[space.Key]
+		status.PruneRefused = plan.Refused
+		for _, c := range plan.Candidates {
+			page := PageStatus{
+				ID:      c.ID,
+				Status:  StatusPrune,
+				OldPath: RelativePath(c.Path),
+				Reason:  c.Reason,
+			}
+			if local, ok := downloader.localMarkdownCache[c.ID]; ok {
+				page.Title = local.Header.Title
+				page.LocalVersion = local.Version
+			}
+			status.Pages = append(status.Pages, page)
+		}
+	}
+
+	result := []SpaceStatus{}
+	for _, status := range bySpace {
+		slices.SortFunc(status.Pages, func(a, b PageStatus) int {
+			return strings.Compare(string(a.path()), string(b.path()))
+		})
+		result = append(result, *status)
+	}
+	slices.SortFunc(result, func(a, b SpaceStatus) int {
+		return strings.Compare(a.Space, b.Space)
+	})
+	return result, nil
+}
+
+// pageStatus compares a listed page to our copy, if any.
+func (downloader *SpacesDownloader) pageStatus(id ContentID, remote RemoteObjectMetadata) (PageStatus, bool, error) {
+	_, recent, err := downloader.LocalVersionIsRecent(id)
+	if err != nil {
+		return PageStatus{}, false, fmt.Errorf("localdump: failed comparing cached versions: %w", err)
+	}
+	if recent {
+		return PageStatus{}, true, nil
+	}
+
+	newPath, err := downloader.PagePath(remote.Page)
+	if err != nil {
+		return PageStatus{}, false, fmt.Errorf("localdump: couldn't determine page path: %w", err)
+	}
+	status := PageStatus{
+		ID:      id,
+		Title:   remote.Page.Title,
+		Status:  StatusNew,
+		NewPath: newPath,
+	}
+	if remote.Page.Version != nil {
+		status.RemoteVersion = remote.Page.Version.Number
+	}
+
+	local, ok := downloader.localMarkdownCache[id]
+	if !ok {
+		return status, false, nil
+	}
+	status.OldPath = local.RelativePath
+	status.LocalVersion = local.Version
+
+	switch {
+	case status.RemoteVersion != local.Version:
+		status.Status = StatusUpdated
+	case local.RelativePath != newPath:
+		status.Status = StatusMoved
+	default:
+		// an ancestor was edited, but nothing we'd notice changed.
+		return PageStatus{}, true, nil
+	}
+	return status, false, nil
+}
+
+func (status PageStatus) path() RelativePath {
+	if status.NewPath != "" {
+		return status.NewPath
+	}
+	return status.OldPath
+}
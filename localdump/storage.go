@@ -0,0 +1,305 @@
+package localdump
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/toothbrush/confluence-dump/confluence"
+)
+
+// BodyFormat is the representation of page bodies we ask Confluence for, and convert from.
+type BodyFormat string
+
+const (
+	// Rendered HTML, with macros already expanded into presentation markup.
+	BodyView BodyFormat = "view"
+	// Confluence's own XHTML, where macros, links and mentions are still what the author put in.
+	BodyStorage BodyFormat = "storage"
+	// Atlassian Document Format, the JSON tree the editor works on; see package adf.
+	BodyADF BodyFormat = "atlas_doc_format"
+)
+
+func ParseBodyFormat(s string) (BodyFormat, error) {
+	switch BodyFormat(s) {
+	case BodyView, BodyStorage, BodyADF:
+		return BodyFormat(s), nil
+	case "":
+		return BodyView, nil
+	}
+	return "", fmt.Errorf("localdump: unknown body format '%s', expected %s, %s or %s", s, BodyView, BodyStorage, BodyADF)
+}
+
+func (downloader *SpacesDownloader) bodyFormat() BodyFormat {
+	if downloader.BodyFormat == "" {
+		return BodyView
+	}
+	return downloader.BodyFormat
+}
+
+var (
+	// The HTML parser doesn't know CDATA, and would make code blocks into comments.
+	cdataPattern = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+	// ... nor that <ri:page/> is self-closing, and would swallow its siblings.
+	selfClosingPattern = regexp.MustCompile(`<((?:ac|ri):[A-Za-z-]+)((?:\s+[^<>]*?)?)\s*/>`)
+)
+
+// storageToHTML rewrites a page's storage format into the HTML that Confluence would render it as,
+// near enough that the view converter and its rules can take it from there.  Where we can do
+// better than the rendered HTML, we do: links to pages and attachments point at the real thing.
+func (downloader *SpacesDownloader) storageToHTML(page *confluence.Page) (string, error) {
+	if page.Body.Storage == nil {
+		return "", fmt.Errorf("localdump: found nil .Body.Storage field for Object ID %s", page.ID)
+	}
+	storage := cdataPattern.ReplaceAllStringFunc(page.Body.Storage.Value, func(cdata string) string {
+		return html.EscapeString(cdataPattern.FindStringSubmatch(cdata)[1])
+	})
+	storage = selfClosingPattern.ReplaceAllString(storage, "<$1$2></$1>")
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(storage))
+	if err != nil {
+		return "", fmt.Errorf("localdump: couldn't parse storage format of %s: %w", page.ID, err)
+	}
+	body := doc.Find("body")
+
+	findTags(body, "ac:link").Each(func(_ int, link *goquery.Selection) {
+		link.ReplaceWithHtml(downloader.storageLink(page, link))
+	})
+	findTags(body, "ac:image").Each(func(_ int, image *goquery.Selection) {
+		image.ReplaceWithHtml(downloader.storageImage(page, image))
+	})
+	findTags(body, "ac:task-list").Each(func(_ int, list *goquery.Selection) {
+		list.ReplaceWithHtml(storageTaskList(list))
+	})
+	findTags(body, "ac:emoticon").Each(func(_ int, emoticon *goquery.Selection) {
+		emoticon.ReplaceWithHtml(html.EscapeString(emoticon.AttrOr("ac:emoji-fallback", "")))
+	})
+	findTags(body, "ac:placeholder").Remove()
+
+	// innermost first, so a macro's body is already converted by the time we get to it.
+	macros := findTags(body, "ac:structured-macro")
+	for i := macros.Length() - 1; i >= 0; i-- {
+		macro := macros.Eq(i)
+		macro.ReplaceWithHtml(storageMacro(macro))
+	}
+
+	out, err := body.Html()
+	if err != nil {
+		return "", fmt.Errorf("localdump: couldn't render storage format of %s: %w", page.ID, err)
+	}
+	return out, nil
+}
+
+// findTags finds descendants by tag name; CSS selectors don't cope with the namespace prefix.
+func findTags(selec *goquery.Selection, name string) *goquery.Selection {
+	return selec.Find("*").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return goquery.NodeName(s) == name
+	})
+}
+
+func childTags(selec *goquery.Selection, name string) *goquery.Selection {
+	return selec.Children().FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return goquery.NodeName(s) == name
+	})
+}
+
+// storageLink turns <ac:link> and the ri: resource inside it into an <a>.
+func (downloader *SpacesDownloader) storageLink(page *confluence.Page, link *goquery.Selection) string {
+	text := ""
+	if body := findTags(link, "ac:link-body"); body.Length() > 0 {
+		text, _ = body.First().Html()
+	} else if body := findTags(link, "ac:plain-text-link-body"); body.Length() > 0 {
+		text = html.EscapeString(body.First().Text())
+	}
+
+	href := ""
+	if user := findTags(link, "ri:user"); user.Length() > 0 {
+		// the mention rule takes it from here.
+		accountID := user.AttrOr("ri:account-id", user.AttrOr("ri:userkey", ""))
+		return fmt.Sprintf(`<a href="/wiki/people/%s" data-account-id="%s">%s</a>`,
+			html.EscapeString(url.PathEscape(accountID)), html.EscapeString(accountID), text)
+	} else if attachment := findTags(link, "ri:attachment"); attachment.Length() > 0 {
+		filename := attachment.AttrOr("ri:filename", "")
+		href = downloader.storageAttachmentURL(page, attachment)
+		if text == "" {
+			text = html.EscapeString(filename)
+		}
+	} else if target := findTags(link, "ri:page").AddSelection(findTags(link, "ri:blog-post")); target.Length() > 0 {
+		title := target.AttrOr("ri:content-title", "")
+		href = downloader.storagePageURL(page, target)
+		if text == "" {
+			text = html.EscapeString(title)
+		}
+	} else if target := findTags(link, "ri:url"); target.Length() > 0 {
+		href = target.AttrOr("ri:value", "")
+	}
+
+	if anchor, ok := link.Attr("ac:anchor"); ok {
+		href += "#" + anchor
+		if text == "" {
+			text = html.EscapeString(anchor)
+		}
+	}
+	if href == "" {
+		return text
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), text)
+}
+
+// storagePageURL links to the page a <ri:page> or <ri:blog-post> names by title, the way Confluence
+// would, so that relativeLink can find our copy.
+func (downloader *SpacesDownloader) storagePageURL(page *confluence.Page, target *goquery.Selection) string {
+	spaceKey := target.AttrOr("ri:space-key", page.SpaceKey)
+	title := target.AttrOr("ri:content-title", "")
+	if title == "" {
+		// a link to an anchor on this very page.
+		return ""
+	}
+
+	kind := confluence.PageContent
+	if goquery.NodeName(target) == "ri:blog-post" {
+		kind = confluence.BlogContent
+	}
+	if id, ok := downloader.contentIDByTitle(spaceKey, title, kind); ok {
+		return fmt.Sprintf("/wiki/spaces/%s/pages/%s", url.PathEscape(spaceKey), id)
+	}
+	return fmt.Sprintf("/wiki/display/%s/%s", url.PathEscape(spaceKey), url.QueryEscape(title))
+}
+
+// storageAttachmentURL is where Confluence serves the attachment a <ri:attachment> names, which is
+// what attachmentLink knows how to point at our copy.
+func (downloader *SpacesDownloader) storageAttachmentURL(page *confluence.Page, attachment *goquery.Selection) string {
+	ownerID := ContentID(page.ID)
+	if owner := findTags(attachment, "ri:page").AddSelection(findTags(attachment, "ri:blog-post")); owner.Length() > 0 {
+		spaceKey := owner.AttrOr("ri:space-key", page.SpaceKey)
+		kind := confluence.PageContent
+		if goquery.NodeName(owner) == "ri:blog-post" {
+			kind = confluence.BlogContent
+		}
+		if id, ok := downloader.contentIDByTitle(spaceKey, owner.AttrOr("ri:content-title", ""), kind); ok {
+			ownerID = id
+		}
+	}
+	return fmt.Sprintf("/wiki/download/attachments/%s/%s", ownerID, url.PathEscape(attachment.AttrOr("ri:filename", "")))
+}
+
+// contentIDByTitle finds a page or blog post we've listed by its space and title, which is how
+// storage format refers to them.  A <ri:page> may also name a folder, but a page of the same title
+// wins.
+func (downloader *SpacesDownloader) contentIDByTitle(spaceKey string, title string, kind confluence.ContentType) (ContentID, bool) {
+	if id, ok := downloader.titleIndex[titleKey{spaceKey, title, kind}]; ok {
+		return id, true
+	}
+	if kind == confluence.PageContent {
+		id, ok := downloader.titleIndex[titleKey{spaceKey, title, confluence.FolderContent}]
+		return id, ok
+	}
+	return "", false
+}
+
+// storageImage turns <ac:image> into an <img>, pointing at the attachment or URL it shows.
+func (downloader *SpacesDownloader) storageImage(page *confluence.Page, image *goquery.Selection) string {
+	src := ""
+	if attachment := findTags(image, "ri:attachment"); attachment.Length() > 0 {
+		src = downloader.storageAttachmentURL(page, attachment)
+	} else if u := findTags(image, "ri:url"); u.Length() > 0 {
+		src = u.AttrOr("ri:value", "")
+	}
+	if src == "" {
+		return ""
+	}
+
+	alt := image.AttrOr("ac:alt", image.AttrOr("ac:title", ""))
+	return fmt.Sprintf(`<img src="%s" alt="%s"/>`, html.EscapeString(src), html.EscapeString(alt))
+}
+
+// storageTaskList turns <ac:task-list> into a list of checkboxes, which is what the task list rule
+// expects.
+func storageTaskList(list *goquery.Selection) string {
+	var b strings.Builder
+	b.WriteString("<ul>")
+	childTags(list, "ac:task").Each(func(_ int, task *goquery.Selection) {
+		checked := ""
+		if strings.TrimSpace(childTags(task, "ac:task-status").Text()) == "complete" {
+			checked = " checked"
+		}
+		body, _ := childTags(task, "ac:task-body").Html()
+		fmt.Fprintf(&b, `<li><input type="checkbox"%s/>%s</li>`, checked, body)
+	})
+	b.WriteString("</ul>")
+	return b.String()
+}
+
+// storageMacro turns an <ac:structured-macro> into the markup Confluence renders it as, for the
+// ones our rules know about.  Of the rest, we keep what the author wrote in the body, if anything.
+func storageMacro(macro *goquery.Selection) string {
+	name := macro.AttrOr("ac:name", "")
+	title := html.EscapeString(macroParam(macro, "title"))
+	richBody, _ := childTags(macro, "ac:rich-text-body").Html()
+	plainBody := html.EscapeString(childTags(macro, "ac:plain-text-body").Text())
+
+	switch name {
+	case "code":
+		header := ""
+		if title != "" {
+			header = fmt.Sprintf(`<div class="codeHeader panelHeader"><b>%s</b></div>`, title)
+		}
+		language := macroParam(macro, "language")
+		return fmt.Sprintf(`<div class="code panel" data-macro-name="code">%s<div class="codeContent panelContent"><pre class="syntaxhighlighter-pre" data-syntaxhighlighter-params="brush: %s">%s</pre></div></div>`,
+			header, html.EscapeString(language), plainBody)
+
+	case "noformat":
+		header := ""
+		if title != "" {
+			header = fmt.Sprintf(`<div class="preformattedHeader panelHeader"><b>%s</b></div>`, title)
+		}
+		return fmt.Sprintf(`<div class="preformatted panel" data-macro-name="noformat">%s<div class="preformattedContent panelContent"><pre>%s</pre></div></div>`,
+			header, plainBody)
+
+	case "info", "note", "warning", "tip":
+		header := ""
+		if title != "" {
+			header = fmt.Sprintf(`<p class="title">%s</p>`, title)
+		}
+		return fmt.Sprintf(`<div class="confluence-information-macro" data-macro-name="%s">%s<div class="confluence-information-macro-body">%s</div></div>`,
+			name, header, richBody)
+
+	case "panel":
+		header := ""
+		if title != "" {
+			header = fmt.Sprintf(`<div class="panelHeader"><b>%s</b></div>`, title)
+		}
+		return fmt.Sprintf(`<div class="panel" data-macro-name="panel">%s<div class="panelContent">%s</div></div>`,
+			header, richBody)
+
+	case "expand":
+		if title == "" {
+			title = "Click here to expand..."
+		}
+		return fmt.Sprintf(`<p><strong>%s</strong></p>%s`, title, richBody)
+
+	case "status":
+		return fmt.Sprintf(`<code>%s</code>`, html.EscapeString(macroParam(macro, "title")))
+	}
+
+	if richBody != "" {
+		return richBody
+	}
+	return plainBody
+}
+
+// macroParam returns the value of <ac:parameter ac:name="...">.
+func macroParam(macro *goquery.Selection, name string) string {
+	value := ""
+	childTags(macro, "ac:parameter").EachWithBreak(func(_ int, param *goquery.Selection) bool {
+		if param.AttrOr("ac:name", "") == name {
+			value = param.Text()
+			return false
+		}
+		return true
+	})
+	return value
+}
@@ -0,0 +1,190 @@
+package localdump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Pruned files end up in here, inside stateDirName, in a directory per run.
+const trashDirName = "trash"
+
+// how we name each run's trash directory: sorts nicely, and doesn't upset any file system.
+const trashBatchLayout = "20060102T150405Z"
+
+// DefaultTrashRetention is how long we keep pruned files around before emptying the trash.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashBatch is what one run pruned.
+type TrashBatch struct {
+	Name string
+	Time time.Time
+
+	// relative to the store, i.e. where they'll be restored to.
+	Files []string
+}
+
+func trashPath(storePath string) string {
+	return path.Join(storePath, stateDirName, trashDirName)
+}
+
+// trashFile moves a file from the store into this run's trash directory, keeping its relative path.
+func (downloader *SpacesDownloader) trashFile(relative string) error {
+	batch := downloader.runStarted.UTC().Format(trashBatchLayout)
+	from := path.Join(downloader.StorePath, relative)
+	to := path.Join(trashPath(downloader.StorePath), batch, relative)
+
+	if err := os.MkdirAll(path.Dir(to), 0750); err != nil {
+		return fmt.Errorf("localdump: couldn't create directory %s: %w", path.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("localdump: couldn't move %s to trash: %w", from, err)
+	}
+	return nil
+}
+
+// ListTrash tells you what's in the trash, oldest first.
+func ListTrash(storePath string) ([]TrashBatch, error) {
+	entries, err := os.ReadDir(trashPath(storePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("localdump: couldn't list trash: %w", err)
+	}
+
+	batches := []TrashBatch{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		when, err := time.Parse(trashBatchLayout, entry.Name())
+		if err != nil {
+			// not ours.
+			continue
+		}
+
+		batch, err := readTrashBatch(storePath, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		batch.Time = when
+		batches = append(batches, batch)
+	}
+
+	slices.SortFunc(batches, func(a, b TrashBatch) int {
+		return a.Time.Compare(b.Time)
+	})
+	return batches, nil
+}
+
+func readTrashBatch(storePath, name string) (TrashBatch, error) {
+	batch := TrashBatch{Name: name}
+	dir := path.Join(trashPath(storePath), name)
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("localdump: error during file tree walk: %w", err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(dir, file)
+		if err != nil {
+			return fmt.Errorf("localdump: failed to get relative path: %w", err)
+		}
+		batch.Files = append(batch.Files, relative)
+		return nil
+	})
+	if err != nil {
+		return TrashBatch{}, fmt.Errorf("localdump: couldn't read trash %s: %w", name, err)
+	}
+
+	return batch, nil
+}
+
+// RestoreTrash moves the files in a batch back where they came from.  We won't overwrite anything
+// that's been written there since: those files stay in the trash and are returned as skipped.
+func RestoreTrash(storePath, name string) (restored []string, skipped []string, err error) {
+	if _, err := time.Parse(trashBatchLayout, name); err != nil {
+		return nil, nil, fmt.Errorf("localdump: %s doesn't look like a trash batch", name)
+	}
+	batch, err := readTrashBatch(storePath, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("localdump: no trash batch %s", name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := path.Join(trashPath(storePath), name)
+	for _, relative := range batch.Files {
+		from := path.Join(dir, relative)
+		to := path.Join(storePath, relative)
+
+		if _, err := os.Stat(to); err == nil {
+			skipped = append(skipped, relative)
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return restored, skipped, fmt.Errorf("localdump: couldn't stat %s: %w", to, err)
+		}
+
+		if err := os.MkdirAll(path.Dir(to), 0750); err != nil {
+			return restored, skipped, fmt.Errorf("localdump: couldn't create directory %s: %w", path.Dir(to), err)
+		}
+		if err := os.Rename(from, to); err != nil {
+			return restored, skipped, fmt.Errorf("localdump: couldn't restore %s: %w", relative, err)
+		}
+		restored = append(restored, relative)
+	}
+
+	if len(skipped) == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			return restored, skipped, fmt.Errorf("localdump: couldn't remove %s: %w", dir, err)
+		}
+	}
+
+	return restored, skipped, nil
+}
+
+// EmptyTrash permanently deletes batches pruned more than olderThan ago (so 0 means all of them).
+func EmptyTrash(storePath string, olderThan time.Duration, now time.Time) ([]TrashBatch, error) {
+	batches, err := ListTrash(storePath)
+	if err != nil {
+		return nil, err
+	}
+
+	emptied := []TrashBatch{}
+	for _, batch := range batches {
+		if now.Sub(batch.Time) < olderThan {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(trashPath(storePath), batch.Name)); err != nil {
+			return emptied, fmt.Errorf("localdump: couldn't empty trash %s: %w", batch.Name, err)
+		}
+		emptied = append(emptied, batch)
+	}
+
+	return emptied, nil
+}
+
+// expireTrash throws out whatever's been in the trash longer than TrashRetention.
+func (downloader *SpacesDownloader) expireTrash() error {
+	if downloader.TrashRetention <= 0 {
+		// keep forever
+		return nil
+	}
+
+	emptied, err := EmptyTrash(downloader.StorePath, downloader.TrashRetention, downloader.runStarted)
+	if err != nil {
+		return err
+	}
+	for _, batch := range emptied {
+		downloader.Logger.Info("Emptied trash", "trashed", batch.Time.Local().Format(time.DateTime), "files", len(batch.Files))
+	}
+	return nil
+}
@@ -32,15 +32,82 @@ func (downloader *SpacesDownloader) WriteMarkdownIntoLocal(contents LocalMarkdow
 		return fmt.Errorf("localdump: couldn't create directory %s: %w", directory, err)
 	}
 
-	f, err := os.Create(abs)
+	if err := atomicWriteFile(abs, []byte(contents.Content), 0644); err != nil {
+		return fmt.Errorf("localdump: couldn't write to file %s: %w", abs, err)
+	}
+
+	return nil
+}
+
+func (downloader *SpacesDownloader) WriteAttachmentIntoLocal(relativePath RelativePath, contents []byte) error {
+	if !downloader.WriteMarkdown {
+		// exit early to dry run
+		return nil
+	}
+
+	abs := path.Join(downloader.StorePath, string(relativePath))
+	directory := path.Dir(abs)
+
+	if err := os.MkdirAll(directory, 0750); err != nil {
+		return fmt.Errorf("localdump: couldn't create directory %s: %w", directory, err)
+	}
+
+	if err := atomicWriteFile(abs, contents, 0644); err != nil {
+		return fmt.Errorf("localdump: couldn't write attachment %s: %w", abs, err)
+	}
+
+	return nil
+}
+
+// atomicWriteFile writes to a temporary file next to filename, and only renames it into place once
+// it's safely on disk.  That way, a crash or a full disk never leaves a truncated file behind, and
+// once we return, the new file is there to stay.
+func atomicWriteFile(filename string, contents []byte, perm os.FileMode) error {
+	dir, base := path.Split(filename)
+	// the dot keeps it out of the way, and the suffix means we won't mistake it for Markdown.
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("localdump: couldn't create file %s: %w", abs, err)
+		return fmt.Errorf("localdump: couldn't create temporary file for %s: %w", filename, err)
 	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
 
-	defer f.Close()
-	if _, err = f.WriteString(contents.Content); err != nil {
-		return fmt.Errorf("localdump: couldn't write to file %s: %w", abs, err)
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("localdump: couldn't write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("localdump: couldn't sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("localdump: couldn't close %s: %w", tmp.Name(), err)
+	}
+	// CreateTemp is rather more private than we'd like.
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("localdump: couldn't set permissions on %s: %w", tmp.Name(), err)
 	}
 
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("localdump: couldn't move %s into place: %w", filename, err)
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory's entries to disk.  Until then, a rename into it may not survive a
+// crash, even though the file itself was synced.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("localdump: couldn't open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("localdump: couldn't sync directory %s: %w", dir, err)
+	}
 	return nil
 }
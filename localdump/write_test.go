@@ -0,0 +1,42 @@
+package localdump
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestAtomicWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "100-page.md")
+
+	for _, contents := range []string{"first version\n", "second\n"} {
+		if err := atomicWriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != contents {
+			t.Errorf("file contains %q, want %q", got, contents)
+		}
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %s, want 0644", info.Mode().Perm())
+	}
+
+	// no temporary files left lying around.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory contains %d entries, want just the file", len(entries))
+	}
+}